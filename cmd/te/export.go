@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/willfish/te/internal/export"
+	"github.com/willfish/te/internal/store"
+)
+
+func runExport(format, output, dbPath string) error {
+	if format != "xml" {
+		return fmt.Errorf("unsupported export format %q (want xml)", format)
+	}
+
+	s, err := store.OpenReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	if output == "" || output == "-" {
+		return export.XML(os.Stdout, s)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", output, err)
+	}
+	if err := export.XML(f, s); err != nil {
+		_ = f.Close()
+		_ = os.Remove(output)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", output, err)
+	}
+	return nil
+}
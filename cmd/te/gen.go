@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/willfish/te/internal/gen"
+	"github.com/willfish/te/internal/store"
+)
+
+// genFile is the file written when te gen go is given a directory.
+const genFile = "te_types.go"
+
+func runGen(lang string, types []string, pkg, output, dbPath string) error {
+	if lang != "go" {
+		return fmt.Errorf("unsupported language %q (want go)", lang)
+	}
+
+	// A directory output gets genFile, in a package named after it.
+	path := output
+	if output != "" && output != "-" && !strings.HasSuffix(output, ".go") {
+		path = filepath.Join(output, genFile)
+	}
+	if pkg == "" {
+		pkg = "tariff"
+		if path != "" && path != "-" {
+			if abs, err := filepath.Abs(filepath.Dir(path)); err == nil {
+				if name := filepath.Base(abs); token.IsIdentifier(name) {
+					pkg = name
+				}
+			}
+		}
+	}
+
+	s, err := store.OpenReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	schemas, err := inferSchemas(s, types)
+	if err != nil {
+		return err
+	}
+	if len(schemas) == 0 {
+		return fmt.Errorf("no elements in %s", dbPath)
+	}
+
+	var b bytes.Buffer
+	if err := gen.Go(&b, pkg, schemas); err != nil {
+		return err
+	}
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(b.Bytes())
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d type(s) to %s (package %s)\n", len(schemas), path, pkg)
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/willfish/te/internal/store"
+)
+
+func runHistory(hjid, dbPath string) error {
+	s, err := store.OpenReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	versions, err := s.ElementHistory(hjid)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("no history for element %s", hjid)
+	}
+
+	fmt.Printf("%s %s: %d version(s)\n", versions[0].Type, hjid, len(versions))
+
+	prev := ""
+	for i, v := range versions {
+		source := v.ImportName
+		if source == "" {
+			source = "-"
+		}
+		op := v.OpType
+		if op == "" {
+			op = "?"
+		}
+		fmt.Printf("\n#%d  op=%s  transactionDate=%s  import=%s\n", i+1, op, v.TransactionDate, source)
+
+		changes, err := store.Diff(prev, v.Data)
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			switch {
+			case c.Old == nil:
+				fmt.Printf("  + %s: %s\n", c.Field, formatValue(c.New))
+			case c.New == nil:
+				fmt.Printf("  - %s: %s\n", c.Field, formatValue(c.Old))
+			default:
+				fmt.Printf("  ~ %s: %s -> %s\n", c.Field, formatValue(c.Old), formatValue(c.New))
+			}
+		}
+		prev = v.Data
+	}
+
+	return nil
+}
+
+func formatValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
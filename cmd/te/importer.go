@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/willfish/te/internal/input"
+	"github.com/willfish/te/internal/parsing"
+	"github.com/willfish/te/internal/store"
+)
+
+func sortFiles(files []string, order string) error {
+	switch order {
+	case "", "filename":
+		return input.Sort(files, func(name string) (string, error) {
+			return input.FilenameDate(name), nil
+		})
+	case "txdate":
+		for _, f := range files {
+			if f == "-" {
+				return fmt.Errorf("stdin can't be ordered by transaction date")
+			}
+		}
+		return input.Sort(files, firstTransactionDate)
+	default:
+		return fmt.Errorf("unknown order %q: want filename or txdate", order)
+	}
+}
+
+func firstTransactionDate(name string) (string, error) {
+	in, err := input.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close() //nolint:errcheck
+
+	doc, err := in.Next()
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", name, err)
+	}
+	date, err := parsing.FirstTransactionDate(doc)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", name, err)
+	}
+	return date, nil
+}
+
+// importer loads inputs into the store, recording each document as an
+// import, while writing records to sink.
+type importer struct {
+	store *store.Store
+	sink  parsing.Sink
+	opts  parsing.Options
+	// resume continues each source's last unfinished import from its
+	// checkpoint, and skips sources whose last import completed.
+	resume bool
+	// warnings collects the key warnings raised while parsing.
+	warnings warnings
+}
+
+// maxWarningExamples bounds how many warnings of each kind are shown.
+const maxWarningExamples = 5
+
+// warnings counts key warnings by kind, keeping the first few of each.
+type warnings struct {
+	missing, collisions []string
+	missingCount        int
+	collisionCount      int
+}
+
+func (w *warnings) add(name string, err error) {
+	msg := name + ": " + err.Error()
+	switch {
+	case errors.Is(err, parsing.ErrKeyCollision):
+		w.collisionCount++
+		if len(w.collisions) < maxWarningExamples {
+			w.collisions = append(w.collisions, msg)
+		}
+	default:
+		w.missingCount++
+		if len(w.missing) < maxWarningExamples {
+			w.missing = append(w.missing, msg)
+		}
+	}
+}
+
+// print summarises the warnings, listing the first few of each kind.
+func (w *warnings) print(out io.Writer) {
+	report := func(count int, what string, examples []string) {
+		if count == 0 {
+			return
+		}
+		fmt.Fprintf(out, "Warning: %d %s\n", count, what)
+		for _, e := range examples {
+			fmt.Fprintf(out, "  %s\n", e)
+		}
+		if count > len(examples) {
+			fmt.Fprintf(out, "  ... and %d more\n", count-len(examples))
+		}
+	}
+	report(w.missingCount, "record(s) lacked their key fields and were keyed by content:", w.missing)
+	report(w.collisionCount, "key collision(s); earlier records were replaced (see te history):", w.collisions)
+}
+
+// all imports each file in turn. Overall progress is weighted by the size of
+// each file when every input is local, and by file count otherwise.
+func (im *importer) all(ctx context.Context, files []string, report func(parseProgress)) error {
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, name := range files {
+		if !input.IsLocal(name) {
+			total = -1
+			break
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("stating file: %w", err)
+		}
+		sizes[i] = fi.Size()
+		total += fi.Size()
+	}
+
+	var done int64
+	for i, name := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		in, err := input.OpenContext(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		p := parseProgress{name: in.Name, index: i + 1, count: len(files)}
+		err = im.input(ctx, in, func(read, size int64) {
+			p.bytes = read
+			p.file = -1
+			if size > 0 {
+				p.file = min(float64(read)/float64(size), 1)
+			}
+			switch {
+			case total > 0:
+				p.overall = (float64(done) + max(p.file, 0)*float64(sizes[i])) / float64(total)
+			case total < 0:
+				p.overall = (float64(i) + max(p.file, 0)) / float64(len(files))
+			}
+			report(p)
+		})
+		_ = in.Close()
+		if err != nil {
+			return err
+		}
+		done += sizes[i]
+	}
+
+	return nil
+}
+
+// input imports every document in in, reporting progress through the stored
+// (possibly compressed) bytes consumed.
+func (im *importer) input(ctx context.Context, in *input.Input, onProgress func(done, total int64)) error {
+	for {
+		doc, err := in.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		pr := &ProgressReader{
+			r:          doc,
+			total:      in.Size,
+			consumed:   in.Consumed,
+			onProgress: onProgress,
+		}
+		if err := im.file(ctx, pr, doc.Name, doc.Size); err != nil {
+			return &sourceError{name: doc.Name, err: err}
+		}
+	}
+}
+
+// sourceError is an error importing the named document.
+type sourceError struct {
+	name string
+	err  error
+}
+
+func (e *sourceError) Error() string { return e.name + ": " + e.err.Error() }
+
+func (e *sourceError) Unwrap() error { return e.err }
+
+// file parses a single document, recording it in the imports table along
+// with a checksum of the bytes read. If parsing fails or is cancelled the
+// uncommitted batch is rolled back and the import is marked as such.
+func (im *importer) file(ctx context.Context, r io.Reader, name string, size int64) error {
+	cr := &checksumReader{r: r, h: sha256.New()}
+	opts := im.opts
+	opts.Warn = func(err error) { im.warnings.add(name, err) }
+
+	resumed := false
+	if im.resume {
+		last, err := im.store.LastImport(name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case last == nil:
+		case last.Status == store.ImportComplete:
+			return nil
+		default:
+			if err := im.store.ResumeImport(last); err != nil {
+				return err
+			}
+			resumed = true
+			opts.Skip = last.Checkpoint.Records
+			cr.verifyAt, cr.want = last.Checkpoint.Bytes, last.Checkpoint.Checksum
+		}
+	}
+	if !resumed {
+		if _, err := im.store.BeginImport(name, size); err != nil {
+			return err
+		}
+	}
+	im.store.SetCheckpointSource(cr.sum)
+
+	if err := parsing.Parse(ctx, cr, im.sink, opts); err != nil {
+		status := store.ImportFailed
+		if errors.Is(err, context.Canceled) {
+			status = store.ImportCancelled
+		}
+		if abortErr := im.store.AbortImport(status); abortErr != nil {
+			return errors.Join(fmt.Errorf("parsing: %w", err), abortErr)
+		}
+		return fmt.Errorf("parsing: %w", err)
+	}
+
+	_, checksum := cr.sum()
+	return im.store.FinishImport(checksum)
+}
+
+// errSourceChanged is returned when a resumed import's source doesn't match
+// the bytes read before it was interrupted.
+var errSourceChanged = errors.New("source has changed since the import was interrupted; parse it again without --resume")
+
+// checksumReader hashes everything read through it. If verifyAt is set it
+// also checks that the first verifyAt bytes hash to want.
+type checksumReader struct {
+	r        io.Reader
+	verifyAt int64
+	want     string
+
+	mu sync.Mutex
+	h  hash.Hash
+	n  int64
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	pending := c.verifyAt - c.n
+	c.mu.Unlock()
+	if pending > 0 && int64(len(p)) > pending {
+		// Stop at the checkpoint so the prefix can be checked exactly.
+		p = p[:pending]
+	}
+
+	n, err := c.r.Read(p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.h.Write(p[:n])
+	c.n += int64(n)
+	if pending > 0 {
+		if c.n == c.verifyAt {
+			if hex.EncodeToString(c.h.Sum(nil)) != c.want {
+				return n, errSourceChanged
+			}
+			c.verifyAt = 0
+		} else if err == io.EOF {
+			return n, errSourceChanged
+		}
+	}
+	return n, err
+}
+
+// sum returns the number of bytes read so far and their checksum. It is
+// safe to call while another goroutine is reading.
+func (c *checksumReader) sum() (int64, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n, hex.EncodeToString(c.h.Sum(nil))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/willfish/te/internal/store"
+)
+
+func runImports(dbPath string) error {
+	s, err := store.OpenReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	imports, err := s.Imports()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSIZE\tSTARTED\tDURATION\tSTATUS\tINSERTED\tDELETED\tREJECTED\tSHA256")
+	for _, im := range imports {
+		duration := "-"
+		if !im.FinishedAt.IsZero() {
+			duration = im.FinishedAt.Sub(im.StartedAt).Round(time.Millisecond).String()
+		}
+		size := "-"
+		if im.Size >= 0 {
+			size = formatBytes(im.Size)
+		}
+		checksum := im.Checksum
+		if len(checksum) > 12 {
+			checksum = checksum[:12]
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+			im.ID, im.Name, size, im.StartedAt.Local().Format(time.DateTime),
+			duration, im.Status, im.Inserted, im.Deleted, im.Rejected, checksum)
+	}
+	return w.Flush()
+}
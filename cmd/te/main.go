@@ -1,20 +1,69 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/willfish/te/internal/parsing"
 	"github.com/willfish/te/internal/store"
 )
 
 const usage = `te - Tariff Enumerator
 
 Usage:
-  te parse <file.xml> [--db path]    Parse XML into SQLite
+  te parse <file|dir|glob>... [flags]
+                                     Parse XML into SQLite
   te browse [--db path]              Launch TUI browser
+  te imports [--db path]             List files loaded into the database
+  te history <hjid> [--db path]      Show every version of an element with diffs
+  te export [--format xml] [-o file] [--db path]
+                                     Rebuild an XML export from the database
+  te search <query> [--type T] [--limit n] [--db path]
+                                     Full-text search of element values
+  te query <type> [filter] [--fields f,g] [--sort f,-g] [--limit n] [--db path]
+                                     Select elements by their field values
+  te sql ["<query>"] [--format table|json|csv] [--write] [--db path]
+                                     Run SQL, or start a console without a query
+  te materialise [type...] [--drop] [--db path]
+                                     Build typed tables (t_Measure, ...) from element data
+  te schema [type...] [--format table|json|jsonschema] [--db path]
+                                     Report the fields found in each type's data
+  te gen go [type...] [--package name] [-o dir|file.go] [--db path]
+                                     Generate Go structs for each type's data
 
 Flags:
   --db path    Database path (default: ~/.cache/te/tariff.db)
+
+Parse flags:
+  --depth n|auto   Record depth, root is 1 (default: 4); auto detects it
+  --path p         Select records by element path, e.g. /Envelope/Body/Measure (repeatable)
+  --name n         Select records by element name wherever they appear (repeatable)
+  --apply          Apply each record's metainfo opType (delete removes, create/update replace)
+  --append         Keep existing elements and layer this file on top
+  --order o        Load multiple files by the date in their name (filename, default)
+                   or by their first metainfo transactionDate (txdate)
+  --jsonl path     Also write each record to path as JSON Lines
+  --workers n      Goroutines processing records (default: number of CPUs)
+  --resume         Continue interrupted imports from their last checkpoint,
+                   skipping files already loaded (implies --append)
+  --lenient        Quarantine bad records in parse_errors instead of failing
+  --key k          Record key: hjid (default), hash, a field such as sid, or
+                   fields joined by + (sid+validityStartDate). Records missing
+                   the fields are keyed by a hash of their content
+  --max-errors n   Bad records tolerated by --lenient before exiting non-zero (default: 0)
+  --split-children Store children with their own metainfo (e.g. measure components)
+                   as separate rows linked by parent_hjid
+  --nested         Also store each record's data before flattening, in elements.nested
+  --materialise    Rebuild the typed t_<Type> tables once the import finishes
+
+Query filters:
+  Compare fields of the flattened data with = != < <= > >=, test them with
+  in ("a", "b"), like "2024-%" or exists, and combine tests with and, or,
+  not and parentheses. Comparing with a number compares numerically:
+    te query Measure 'geographicalArea.areaId = "1011" and validityStartDate >= "2024-01-01"'
 `
 
 func main() {
@@ -27,21 +76,45 @@ func main() {
 
 	switch os.Args[1] {
 	case "parse":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Usage: te parse <file.xml> [--db path]")
+		cfg := parseConfig{dbPath: dbPath}
+		var materialise bool
+		fs := flag.NewFlagSet("parse", flag.ExitOnError)
+		fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+		fs.StringVar(&cfg.dbPath, "db", dbPath, "database path")
+		fs.Var((*depthFlag)(&cfg.parse.Depth), "depth", "record depth or auto")
+		fs.Var((*listFlag)(&cfg.parse.Paths), "path", "record element path")
+		fs.Var((*listFlag)(&cfg.parse.Names), "name", "record element name")
+		fs.BoolVar(&cfg.parse.Apply, "apply", false, "apply metainfo create/update/delete operations")
+		fs.BoolVar(&cfg.store.Append, "append", false, "keep existing elements")
+		fs.StringVar(&cfg.order, "order", "filename", "file load order: filename or txdate")
+		fs.StringVar(&cfg.jsonl, "jsonl", "", "also write records to this file as JSON Lines")
+		fs.IntVar(&cfg.parse.Workers, "workers", 0, "goroutines processing records")
+		fs.BoolVar(&cfg.resume, "resume", false, "continue interrupted imports")
+		fs.BoolVar(&cfg.parse.Lenient, "lenient", false, "quarantine bad records instead of failing")
+		fs.Var((*keyFlag)(&cfg.parse.Key), "key", "record key: hjid, hash, field or field+field")
+		fs.IntVar(&cfg.maxErrors, "max-errors", 0, "bad records tolerated by --lenient")
+		fs.BoolVar(&cfg.parse.SplitChildren, "split-children", false, "store children with metainfo as separate rows")
+		fs.BoolVar(&cfg.parse.Nested, "nested", false, "also store data before flattening")
+		fs.BoolVar(&materialise, "materialise", false, "rebuild typed tables after the import")
+
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Usage: te parse <file|dir|glob>... [flags]")
 			os.Exit(1)
 		}
-		filename := os.Args[2]
-		for i := 3; i < len(os.Args); i++ {
-			if os.Args[i] == "--db" && i+1 < len(os.Args) {
-				dbPath = os.Args[i+1]
-				i++
-			}
+		if cfg.resume {
+			cfg.store.Append = true
 		}
-		if err := runParse(filename, dbPath); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if err := runParse(args, cfg); err != nil {
+			printParseError(os.Stderr, err)
 			os.Exit(1)
 		}
+		if materialise {
+			if err := runMaterialise(nil, false, cfg.dbPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
 
 	case "browse":
 		for i := 2; i < len(os.Args); i++ {
@@ -55,6 +128,163 @@ func main() {
 			os.Exit(1)
 		}
 
+	case "imports":
+		fs := flag.NewFlagSet("imports", flag.ExitOnError)
+		fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+		fs.StringVar(&dbPath, "db", dbPath, "database path")
+
+		if args := parseArgs(fs, os.Args[2:]); len(args) != 0 {
+			fmt.Fprintln(os.Stderr, "Usage: te imports [--db path]")
+			os.Exit(1)
+		}
+		if err := runImports(dbPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "history":
+		fs := flag.NewFlagSet("history", flag.ExitOnError)
+		fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+		fs.StringVar(&dbPath, "db", dbPath, "database path")
+
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "Usage: te history <hjid> [--db path]")
+			os.Exit(1)
+		}
+		if err := runHistory(args[0], dbPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "export":
+		var format, output string
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+		fs.StringVar(&dbPath, "db", dbPath, "database path")
+		fs.StringVar(&format, "format", "xml", "export format")
+		fs.StringVar(&output, "o", "", "output file (default: stdout)")
+
+		if args := parseArgs(fs, os.Args[2:]); len(args) != 0 {
+			fmt.Fprintln(os.Stderr, "Usage: te export [--format xml] [-o file] [--db path]")
+			os.Exit(1)
+		}
+		if err := runExport(format, output, dbPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "search":
+		var elementType string
+		var limit int
+		fs := flag.NewFlagSet("search", flag.ExitOnError)
+		fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+		fs.StringVar(&dbPath, "db", dbPath, "database path")
+		fs.StringVar(&elementType, "type", "", "only search elements of this type")
+		fs.IntVar(&limit, "limit", 20, "maximum results")
+
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Usage: te search <query> [--type T] [--limit n] [--db path]")
+			os.Exit(1)
+		}
+		if err := runSearch(strings.Join(args, " "), elementType, limit, dbPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "query":
+		var q store.Query
+		var fields, sort string
+		fs := flag.NewFlagSet("query", flag.ExitOnError)
+		fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+		fs.StringVar(&dbPath, "db", dbPath, "database path")
+		fs.StringVar(&fields, "fields", "", "comma-separated fields to show")
+		fs.StringVar(&sort, "sort", "", "comma-separated fields to sort by, - prefix for descending")
+		fs.IntVar(&q.Limit, "limit", 0, "maximum results (default: all)")
+
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) < 1 || len(args) > 2 {
+			fmt.Fprintln(os.Stderr, "Usage: te query <type> [filter] [--fields f,g] [--sort f,-g] [--limit n] [--db path]")
+			os.Exit(1)
+		}
+		q.Type = args[0]
+		if len(args) == 2 {
+			q.Filter = args[1]
+		}
+		q.Fields = splitList(fields)
+		q.Sort = splitList(sort)
+		if err := runQuery(q, dbPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "sql":
+		cfg := sqlConfig{dbPath: dbPath}
+		fs := flag.NewFlagSet("sql", flag.ExitOnError)
+		fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+		fs.StringVar(&cfg.dbPath, "db", dbPath, "database path")
+		fs.StringVar(&cfg.format, "format", "table", "output format: table, json or csv")
+		fs.BoolVar(&cfg.write, "write", false, "allow statements that change the database")
+
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) > 1 {
+			fmt.Fprintln(os.Stderr, `Usage: te sql ["<query>"] [--format table|json|csv] [--write] [--db path]`)
+			os.Exit(1)
+		}
+		var query string
+		if len(args) == 1 {
+			query = args[0]
+		}
+		if err := runSQL(query, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "materialise", "materialize":
+		var drop bool
+		fs := flag.NewFlagSet("materialise", flag.ExitOnError)
+		fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+		fs.StringVar(&dbPath, "db", dbPath, "database path")
+		fs.BoolVar(&drop, "drop", false, "remove the tables instead of building them")
+
+		types := parseArgs(fs, os.Args[2:])
+		if err := runMaterialise(types, drop, dbPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "schema":
+		var format string
+		fs := flag.NewFlagSet("schema", flag.ExitOnError)
+		fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+		fs.StringVar(&dbPath, "db", dbPath, "database path")
+		fs.StringVar(&format, "format", "table", "output format: table, json or jsonschema")
+
+		types := parseArgs(fs, os.Args[2:])
+		if err := runSchema(types, format, dbPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "gen":
+		var pkg, output string
+		fs := flag.NewFlagSet("gen", flag.ExitOnError)
+		fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+		fs.StringVar(&dbPath, "db", dbPath, "database path")
+		fs.StringVar(&pkg, "package", "", "package name (default: the output directory's name, or tariff)")
+		fs.StringVar(&output, "o", "", "output directory or .go file (default: stdout)")
+
+		args := parseArgs(fs, os.Args[2:])
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Usage: te gen go [type...] [--package name] [-o dir|file.go] [--db path]")
+			os.Exit(1)
+		}
+		if err := runGen(args[0], args[1:], pkg, output, dbPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
 	case "--help", "-h", "help":
 		fmt.Print(usage)
 
@@ -63,3 +293,73 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// parseArgs parses flags that may appear before, between or after positional
+// arguments and returns the positional arguments in order.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = fs.Parse(args) // ExitOnError
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+type depthFlag int
+
+func (d *depthFlag) String() string {
+	if *d == parsing.DepthAuto {
+		return "auto"
+	}
+	return strconv.Itoa(int(*d))
+}
+
+func (d *depthFlag) Set(v string) error {
+	if v == "auto" {
+		*d = parsing.DepthAuto
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return fmt.Errorf("depth must be a positive integer or auto")
+	}
+	*d = depthFlag(n)
+	return nil
+}
+
+type keyFlag parsing.Key
+
+func (k *keyFlag) String() string { return parsing.Key(*k).String() }
+
+func (k *keyFlag) Set(v string) error {
+	key, err := parsing.ParseKey(v)
+	if err != nil {
+		return err
+	}
+	*k = keyFlag(key)
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/willfish/te/internal/store"
+)
+
+func runMaterialise(types []string, drop bool, dbPath string) error {
+	s, err := store.OpenWith(dbPath, store.OpenOptions{Append: true})
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	if drop {
+		return s.DropMaterialised(types)
+	}
+
+	tables, err := s.Materialise(types)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tTABLE\tCOLUMNS\tINDEXES\tROWS")
+	for _, t := range tables {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", t.Type, t.Table, t.Columns, t.Indexes, t.Rows)
+	}
+	return w.Flush()
+}
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/stopwatch"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"golang.org/x/term"
 
+	"github.com/willfish/te/internal/input"
 	"github.com/willfish/te/internal/parsing"
 	"github.com/willfish/te/internal/store"
 )
@@ -24,24 +30,42 @@ const (
 var helpStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#626262")).Render
 
 type ProgressReader struct {
-	r          io.Reader
-	total      int64
-	read       int64
-	onProgress func(float64)
+	r     io.Reader
+	total int64 // -1 if unknown
+	read  int64
+	// consumed, if set, reports bytes consumed from the underlying source,
+	// which differs from bytes read when the source is compressed.
+	consumed   func() int64
+	onProgress func(done, total int64)
 }
 
 func (pr *ProgressReader) Read(p []byte) (int, error) {
 	n, err := pr.r.Read(p)
 	pr.read += int64(n)
-	if pr.total > 0 && pr.onProgress != nil {
-		pr.onProgress(float64(pr.read) / float64(pr.total))
+	if pr.onProgress != nil {
+		done := pr.read
+		if pr.consumed != nil {
+			done = pr.consumed()
+		}
+		pr.onProgress(done, pr.total)
 	}
 	return n, err
 }
 
-type progressUpdateMsg float64
+// parseProgress reports progress through the current file and across every
+// file in the run.
+type parseProgress struct {
+	name    string
+	index   int // 1-based position of the current file
+	count   int
+	bytes   int64   // stored bytes consumed from the current file
+	file    float64 // fraction of the current file, or -1 if its size is unknown
+	overall float64
+}
+
+type progressUpdateMsg parseProgress
 
-func watchProgress(ch <-chan float64) tea.Cmd {
+func watchProgress(ch <-chan parseProgress) tea.Cmd {
 	return func() tea.Msg {
 		p, ok := <-ch
 		if !ok {
@@ -55,7 +79,10 @@ type progressDoneMsg struct{}
 
 type parseModel struct {
 	stopwatch stopwatch.Model
+	spinner   spinner.Model
 	progress  progress.Model
+	overall   progress.Model
+	current   parseProgress
 	done      bool
 }
 
@@ -63,6 +90,7 @@ func (m parseModel) Init() tea.Cmd {
 	return tea.Batch(
 		watchProgress(progressCh),
 		m.stopwatch.Init(),
+		m.spinner.Tick,
 	)
 }
 
@@ -82,32 +110,41 @@ func (m parseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.progress.Width > maxWidth {
 			m.progress.Width = maxWidth
 		}
+		m.overall.Width = m.progress.Width
 		return m, tea.Batch(cmds...)
 
 	case progressDoneMsg:
 		m.done = true
-		cmd := m.progress.IncrPercent(1.0 - m.progress.Percent())
-		cmds = append(cmds, cmd, m.stopwatch.Stop(), tea.Quit)
+		cmds = append(cmds,
+			m.progress.IncrPercent(1.0-m.progress.Percent()),
+			m.overall.IncrPercent(1.0-m.overall.Percent()),
+			m.stopwatch.Stop(), tea.Quit)
 		return m, tea.Batch(cmds...)
 
 	case progressUpdateMsg:
-		current := m.progress.Percent()
-		newPercent := float64(msg)
-		if newPercent >= 1.0 {
-			newPercent = 1.0
+		m.current = parseProgress(msg)
+		if m.current.overall >= 1.0 {
 			cmds = append(cmds, m.stopwatch.Stop())
 		}
 
-		delta := newPercent - current
-		cmd := m.progress.IncrPercent(delta)
-		cmds = append(cmds, cmd, watchProgress(progressCh))
+		cmds = append(cmds,
+			m.progress.SetPercent(max(min(m.current.file, 1.0), 0)),
+			m.overall.SetPercent(min(m.current.overall, 1.0)),
+			watchProgress(progressCh))
+
+		return m, tea.Batch(cmds...)
 
+	case spinner.TickMsg:
+		m.spinner, cmd = m.spinner.Update(msg)
+		cmds = append(cmds, cmd)
 		return m, tea.Batch(cmds...)
 
 	case progress.FrameMsg:
 		progressModel, cmd := m.progress.Update(msg)
 		m.progress = progressModel.(progress.Model)
-		cmds = append(cmds, cmd)
+		overallModel, overallCmd := m.overall.Update(msg)
+		m.overall = overallModel.(progress.Model)
+		cmds = append(cmds, cmd, overallCmd)
 		return m, tea.Batch(cmds...)
 
 	default:
@@ -120,96 +157,245 @@ func (m parseModel) View() string {
 	centerStyle := lipgloss.NewStyle().Width(m.progress.Width).Align(lipgloss.Center)
 	stopwatchCentered := centerStyle.Render("Elapsed: " + m.stopwatch.View())
 	progressCentered := centerStyle.Render(m.progress.View())
+	if m.current.file < 0 && !m.done {
+		progressCentered = centerStyle.Render(m.spinner.View() + " " + formatBytes(m.current.bytes) + " read")
+	}
 
-	status := "Press any key to quit"
+	status := "Press any key to cancel"
 	if m.done {
 		status = "Done! Press any key to quit"
 	}
 	help := helpStyle(status)
 
-	return "\n" + pad + stopwatchCentered + "\n\n" + pad + progressCentered + "\n\n" + pad + help
+	if m.current.count <= 1 {
+		return "\n" + pad + stopwatchCentered + "\n\n" + pad + progressCentered + "\n\n" + pad + help
+	}
+
+	label := centerStyle.Render(fmt.Sprintf("[%d/%d] %s", m.current.index, m.current.count, m.current.name))
+	overallCentered := centerStyle.Render(m.overall.View())
+	return "\n" + pad + stopwatchCentered + "\n\n" + pad + label + "\n" + pad + progressCentered +
+		"\n\n" + pad + centerStyle.Render("Overall") + "\n" + pad + overallCentered + "\n\n" + pad + help
 }
 
-var progressCh chan float64
+var progressCh chan parseProgress
+
+type parseConfig struct {
+	dbPath string
+	// order is how files are sorted before loading: "filename" by the
+	// date in their name, or "txdate" by their first transaction date.
+	order string
+	parse parsing.Options
+	store store.OpenOptions
+	// jsonl, if set, is a path to also write records to as JSON Lines.
+	jsonl string
+	// resume continues interrupted imports from their last checkpoint.
+	resume bool
+	// maxErrors is the number of records lenient mode may quarantine
+	// before the run is reported as failed.
+	maxErrors int
+}
 
-func runParse(filename, dbPath string) error {
-	f, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("opening file: %w", err)
-	}
-	defer f.Close() //nolint:errcheck
+// errCancelled is returned when the user interrupts a parse.
+var errCancelled = errors.New("import cancelled; committed batches were kept, run again with --resume to continue")
+
+func runParse(args []string, cfg parseConfig) error {
+	// SIGINT and SIGTERM cancel the import so the current batch is rolled
+	// back and the import marked cancelled rather than left half-written.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	fi, err := f.Stat()
+	files, err := input.Expand(args)
 	if err != nil {
-		return fmt.Errorf("stating file: %w", err)
+		return err
+	}
+	if err := sortFiles(files, cfg.order); err != nil {
+		return err
 	}
 
-	s, err := store.Open(dbPath)
+	s, err := store.OpenWith(cfg.dbPath, cfg.store)
 	if err != nil {
 		return fmt.Errorf("opening store: %w", err)
 	}
 
+	im := &importer{store: s, sink: s, opts: cfg.parse, resume: cfg.resume}
+	sinks := parsing.MultiSink{s}
+	// closeJSONL flushes and closes the --jsonl file once parsing is done.
+	closeJSONL := func() error { return nil }
+	if cfg.jsonl != "" {
+		f, err := os.Create(cfg.jsonl)
+		if err != nil {
+			_ = s.Close()
+			return fmt.Errorf("creating %s: %w", cfg.jsonl, err)
+		}
+		// Only reached on failure; closeJSONL closes it otherwise.
+		defer f.Close() //nolint:errcheck
+
+		jsonl := parsing.NewJSONLSink(f)
+		sinks = append(sinks, jsonl)
+		closeJSONL = func() error {
+			if err := jsonl.Close(); err != nil {
+				return fmt.Errorf("writing %s: %w", cfg.jsonl, err)
+			}
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("closing %s: %w", cfg.jsonl, err)
+			}
+			return nil
+		}
+	}
+	var counts parsing.CountingSink
+	if cfg.parse.Lenient {
+		sinks = append(sinks, &counts)
+	}
+	if len(sinks) > 1 {
+		im.sink = sinks
+	}
+
 	// Non-interactive: parse synchronously with text progress
 	if !term.IsTerminal(int(os.Stdout.Fd())) {
 		defer s.Close() //nolint:errcheck
 
-		lastPct := -1
-		pr := &ProgressReader{
-			r:     f,
-			total: fi.Size(),
-			onProgress: func(p float64) {
-				pct := int(p * 100)
-				if pct > lastPct {
-					lastPct = pct
-					fmt.Fprintf(os.Stderr, "\rParsing... %d%%", pct)
+		last := parseProgress{}
+		lastStep := int64(-1)
+		err := im.all(ctx, files, func(p parseProgress) {
+			if p.index != last.index && last.index != 0 {
+				fmt.Fprintln(os.Stderr)
+			}
+
+			// Report whole percentages, or whole megabytes when the size
+			// is unknown.
+			step, status := int64(p.file*100), fmt.Sprintf("%d%%", int(p.file*100))
+			if p.file < 0 {
+				step, status = p.bytes>>20, formatBytes(p.bytes)
+			}
+			if step > lastStep || p.index != last.index {
+				lastStep = step
+				if p.count > 1 {
+					fmt.Fprintf(os.Stderr, "\r[%d/%d] %s... %s (overall %d%%)",
+						p.index, p.count, p.name, status, int(p.overall*100))
+				} else {
+					fmt.Fprintf(os.Stderr, "\rParsing... %s", status)
 				}
-			},
+			}
+			last = p
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			if errors.Is(err, context.Canceled) {
+				return errCancelled
+			}
+			return err
 		}
-
-		if err := parsing.Parse(pr, s); err != nil {
-			return fmt.Errorf("parsing: %w", err)
+		if len(files) > 1 {
+			fmt.Fprintf(os.Stderr, "\nParsed %d files.\n", len(files))
+		} else {
+			fmt.Fprintln(os.Stderr, "\rParsing... done.")
 		}
-		fmt.Fprintln(os.Stderr, "\rParsing... done.")
-		return nil
+		if err := closeJSONL(); err != nil {
+			return err
+		}
+		im.warnings.print(os.Stderr)
+		return checkRejected(counts.Rejected, cfg.maxErrors)
 	}
 
-	// Interactive: parse in background goroutine with BubbleTea progress UI
-	progressCh = make(chan float64)
+	// Interactive: parse in background goroutine with BubbleTea progress UI.
+	// Quitting the UI cancels the parse.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	progressCh = make(chan parseProgress)
 	parseErr := make(chan error, 1)
 
-	pr := &ProgressReader{
-		r:     f,
-		total: fi.Size(),
-		onProgress: func(p float64) {
+	go func() {
+		parseErr <- im.all(ctx, files, func(p parseProgress) {
 			select {
 			case progressCh <- p:
 			default:
 			}
-		},
-	}
-
-	go func() {
-		parseErr <- parsing.Parse(pr, s)
+		})
 		close(progressCh)
 	}()
 
 	m := parseModel{
 		stopwatch: stopwatch.New(),
+		spinner:   spinner.New(spinner.WithSpinner(spinner.Dot)),
 		progress:  progress.New(progress.WithDefaultGradient()),
+		overall:   progress.New(progress.WithDefaultGradient()),
+		current:   parseProgress{count: len(files)},
 	}
 
-	if _, err := tea.NewProgram(m).Run(); err != nil {
-		// Wait for goroutine before closing store
-		<-parseErr
+	_, uiErr := tea.NewProgram(m).Run()
+	cancel()
+
+	// Wait for the parse goroutine to stop before closing the store.
+	err = <-parseErr
+	if uiErr != nil {
 		_ = s.Close()
-		return fmt.Errorf("running progress UI: %w", err)
+		return fmt.Errorf("running progress UI: %w", uiErr)
 	}
-
-	// Wait for parse goroutine to finish
-	if err := <-parseErr; err != nil {
+	if errors.Is(err, context.Canceled) {
 		_ = s.Close()
-		return fmt.Errorf("parsing: %w", err)
+		return errCancelled
 	}
+	if err != nil {
+		_ = s.Close()
+		return err
+	}
+
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if err := closeJSONL(); err != nil {
+		return err
+	}
+	im.warnings.print(os.Stderr)
+	return checkRejected(counts.Rejected, cfg.maxErrors)
+}
 
-	return s.Close()
+// checkRejected summarises the records quarantined in lenient mode, failing
+// if there were more than maxErrors.
+func checkRejected(rejected, maxErrors int) error {
+	if rejected == 0 {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Quarantined %d bad record(s) in the parse_errors table.\n", rejected)
+	if rejected > maxErrors {
+		return fmt.Errorf("%d bad record(s) exceeds --max-errors %d", rejected, maxErrors)
+	}
+	return nil
+}
+
+// printParseError reports a parse failure, setting out where in the input it
+// happened when that is known.
+func printParseError(w io.Writer, err error) {
+	var pe *parsing.ParseError
+	if !errors.As(err, &pe) {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		return
+	}
+
+	var se *sourceError
+	if errors.As(err, &se) {
+		fmt.Fprintf(w, "Error: %s: %v\n", se.name, pe.Err)
+	} else {
+		fmt.Fprintf(w, "Error: %v\n", pe.Err)
+	}
+	fmt.Fprintf(w, "  at line %d, column %d (byte %d)\n", pe.Line, pe.Column, pe.Offset)
+	if pe.Path != "" {
+		fmt.Fprintf(w, "  in %s\n", pe.Path)
+	}
+	if pe.Hjid != "" {
+		fmt.Fprintf(w, "  near hjid %s\n", pe.Hjid)
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/willfish/te/internal/store"
+)
+
+// queryRecord is how te query writes an element without --fields, in the
+// shape --jsonl uses.
+type queryRecord struct {
+	Hjid string          `json:"hjid"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func runQuery(q store.Query, dbPath string) error {
+	s, err := store.OpenReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	elements, err := s.Query(q)
+	if err != nil {
+		return err
+	}
+
+	if len(q.Fields) == 0 {
+		w := bufio.NewWriter(os.Stdout)
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		for _, e := range elements {
+			if err := enc.Encode(queryRecord{e.Hjid, e.Type, json.RawMessage(e.Data)}); err != nil {
+				return fmt.Errorf("writing %s: %w", e.Hjid, err)
+			}
+		}
+		return w.Flush()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "HJID")
+	for _, f := range q.Fields {
+		fmt.Fprintf(w, "\t%s", f)
+	}
+	fmt.Fprintln(w)
+	for _, e := range elements {
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(e.Data), &values); err != nil {
+			return fmt.Errorf("decoding %s: %w", e.Hjid, err)
+		}
+		fmt.Fprint(w, e.Hjid)
+		for _, f := range q.Fields {
+			v := "-"
+			if values[f] != nil {
+				v = fmt.Sprint(values[f])
+			}
+			fmt.Fprintf(w, "\t%s", v)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
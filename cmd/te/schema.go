@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/willfish/te/internal/store"
+)
+
+// maxExample is the longest example value printed in a table.
+const maxExample = 40
+
+func runSchema(types []string, format, dbPath string) error {
+	switch format {
+	case "table", "json", "jsonschema":
+	default:
+		return fmt.Errorf("unsupported format %q (want table, json or jsonschema)", format)
+	}
+
+	s, err := store.OpenReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	schemas, err := inferSchemas(s, types)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	switch format {
+	case "json":
+		return enc.Encode(schemas)
+	case "jsonschema":
+		return enc.Encode(jsonSchema(schemas))
+	}
+
+	for i, ts := range schemas {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s: %d element(s), %d field(s)\n", ts.Type, ts.Elements, len(ts.Fields))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FIELD\tTYPES\tFORMAT\tABSENT\tNULL\tDISTINCT\tLENGTH\tEXAMPLES")
+		for _, f := range ts.Fields {
+			format := f.Format
+			if format == "" {
+				format = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d-%d\t%s\n",
+				f.Path, strings.Join(f.Types, "|"), format,
+				percent(ts.Elements-f.Present, ts.Elements), percent(f.Nulls, ts.Elements),
+				f.Distinct, f.MinLength, f.MaxLength, examples(f.Examples))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inferSchemas infers the schema of each named type, or of every stored
+// type when none are named.
+func inferSchemas(s *store.Store, types []string) ([]store.TypeSchema, error) {
+	if len(types) == 0 {
+		counts, err := s.TypeCounts()
+		if err != nil {
+			return nil, err
+		}
+		for _, tc := range counts {
+			types = append(types, tc.Type)
+		}
+	}
+
+	var schemas []store.TypeSchema
+	for _, t := range types {
+		ts, err := s.InferSchema(t)
+		if err != nil {
+			return nil, err
+		}
+		if ts.Elements == 0 {
+			return nil, fmt.Errorf("no elements of type %s", t)
+		}
+		schemas = append(schemas, ts)
+	}
+	return schemas, nil
+}
+
+func percent(n, total int) string {
+	if n == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+}
+
+func examples(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		if r := []rune(v); len(r) > maxExample {
+			v = string(r[:maxExample]) + "..."
+		}
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// jsonSchema describes the types as a JSON Schema document: the type's own
+// schema for one type, or one definition per type for several.
+func jsonSchema(schemas []store.TypeSchema) map[string]interface{} {
+	const dialect = "https://json-schema.org/draft/2020-12/schema"
+	if len(schemas) == 1 {
+		doc := typeJSONSchema(schemas[0])
+		doc["$schema"] = dialect
+		return doc
+	}
+	defs := map[string]interface{}{}
+	for _, ts := range schemas {
+		defs[ts.Type] = typeJSONSchema(ts)
+	}
+	return map[string]interface{}{"$schema": dialect, "$defs": defs}
+}
+
+func typeJSONSchema(ts store.TypeSchema) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for _, f := range ts.Fields {
+		prop := map[string]interface{}{}
+		if len(f.Types) == 1 {
+			prop["type"] = f.Types[0]
+		} else {
+			prop["type"] = f.Types
+		}
+		for _, t := range f.Types {
+			if t == "string" {
+				prop["minLength"] = f.MinLength
+				prop["maxLength"] = f.MaxLength
+				if f.Format == "date" || f.Format == "date-time" {
+					prop["format"] = f.Format
+				}
+			}
+		}
+		if len(f.Examples) > 0 {
+			values := make([]interface{}, len(f.Examples))
+			for i, e := range f.Examples {
+				values[i] = exampleValue(e, f.Types)
+			}
+			prop["examples"] = values
+		}
+		properties[f.Path] = prop
+		if f.Required(ts.Elements) {
+			required = append(required, f.Path)
+		}
+	}
+	return map[string]interface{}{
+		"title":      ts.Type,
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// exampleValue returns an example as its JSON value when the field isn't
+// text, so numbers and booleans keep their type.
+func exampleValue(example string, types []string) interface{} {
+	for _, t := range types {
+		if t == "string" {
+			return example
+		}
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(example), &v); err != nil {
+		return example
+	}
+	return v
+}
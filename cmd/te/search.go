@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/willfish/te/internal/store"
+)
+
+func runSearch(query, elementType string, limit int, dbPath string) error {
+	s, err := store.OpenReadOnly(dbPath)
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	results, err := s.Search(query, elementType, limit)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no elements match %q", query)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HJID\tTYPE\tMATCH")
+	for _, r := range results {
+		// Snippets can span lines of the original text.
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Hjid, r.Type, strings.Join(strings.Fields(r.Snippet), " "))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/willfish/te/internal/store"
+	"golang.org/x/term"
+)
+
+const sqlHelp = `Statements end with ; and may span lines. Commands:
+  .mode table|json|csv   Output format
+  .tables                List tables and views
+  .schema [name]         Show the SQL that created a table or view
+  .history [n]           Show the last n statements (default: 20)
+  .help                  Show this help
+  .quit                  Exit
+Helper views: element_fields (one row per field), element_imports
+(elements with their file) and element_children (child records with
+their parents).
+`
+
+// historySize is how many statements the history file keeps.
+const historySize = 1000
+
+type sqlConfig struct {
+	dbPath string
+	format string
+	write  bool
+}
+
+func runSQL(query string, cfg sqlConfig) error {
+	if _, err := newResultWriter(cfg.format, io.Discard); err != nil {
+		return err
+	}
+
+	var s *store.Store
+	var err error
+	if cfg.write {
+		s, err = store.OpenWith(cfg.dbPath, store.OpenOptions{Append: true})
+	} else {
+		s, err = store.OpenReadOnly(cfg.dbPath)
+	}
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	switch {
+	case query != "":
+		err = readOnlyHint(runStatement(s, cfg.format, os.Stdout, query), cfg)
+	case !term.IsTerminal(int(os.Stdin.Fd())):
+		err = readOnlyHint(runScript(s, cfg.format, os.Stdin), cfg)
+	default:
+		err = runREPL(s, cfg)
+	}
+	// Bring the search index and materialised tables up to date with
+	// whatever was written.
+	if cfg.write {
+		if ferr := s.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// readOnlyHint points at --write when a statement was refused for writing
+// or attaching a database.
+func readOnlyHint(err error, cfg sqlConfig) error {
+	switch {
+	case err == nil || cfg.write:
+	case strings.Contains(err.Error(), "readonly database"):
+		return fmt.Errorf("%w (the database is opened read-only; use --write to change it)", err)
+	case strings.Contains(err.Error(), "too many attached databases"):
+		return fmt.Errorf("%w (ATTACH is refused read-only; use --write to allow it)", err)
+	}
+	return err
+}
+
+func runStatement(s *store.Store, format string, out io.Writer, query string, args ...interface{}) error {
+	w, err := newResultWriter(format, out)
+	if err != nil {
+		return err
+	}
+	if err := s.SQL(w, query, args...); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// runScript runs the statements read from r, stopping at the first error.
+func runScript(s *store.Store, format string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var stmt strings.Builder
+	for scanner.Scan() {
+		stmt.WriteString(scanner.Text())
+		stmt.WriteString("\n")
+		if complete(stmt.String()) {
+			if err := runStatement(s, format, os.Stdout, stmt.String()); err != nil {
+				return err
+			}
+			stmt.Reset()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading statements: %w", err)
+	}
+	if strings.TrimSpace(stmt.String()) != "" {
+		return runStatement(s, format, os.Stdout, stmt.String())
+	}
+	return nil
+}
+
+// complete reports whether a statement has been ended with a semicolon,
+// as sqlite3_complete does: semicolons in quotes and comments don't count,
+// nor do those inside a CREATE TRIGGER's BEGIN ... END.
+func complete(stmt string) bool {
+	var words []string // the statement's words, upper-cased, since the last ;
+	ended := false
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		switch {
+		case c == '-' && strings.HasPrefix(stmt[i:], "--"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				end = len(stmt) - i
+			}
+			i += end + 1
+			continue
+		case c == '/' && strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 4
+			continue
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closer := c
+			if c == '[' {
+				closer = ']'
+			}
+			// A doubled quote inside a literal closes and reopens it.
+			end := strings.IndexByte(stmt[i+1:], closer)
+			if end < 0 {
+				return false
+			}
+			i += end + 2
+			words = append(words, "")
+			ended = false
+			continue
+		case c == ';':
+			ended = true
+			if trigger(words) {
+				words = append(words, ";")
+			} else {
+				words = nil
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+		default:
+			j := i + 1
+			if isWordByte(c) {
+				for j < len(stmt) && isWordByte(stmt[j]) {
+					j++
+				}
+			}
+			words = append(words, strings.ToUpper(stmt[i:j]))
+			ended = false
+			i = j
+			continue
+		}
+		i++
+	}
+	return ended && len(words) == 0
+}
+
+// trigger reports whether words begin a CREATE TRIGGER whose END hasn't
+// been reached, so a semicolon doesn't end it.
+func trigger(words []string) bool {
+	if len(words) < 2 || words[0] != "CREATE" {
+		return false
+	}
+	next := words[1]
+	if (next == "TEMP" || next == "TEMPORARY") && len(words) > 2 {
+		next = words[2]
+	}
+	if next != "TRIGGER" {
+		return false
+	}
+	// The trigger ends at END followed by the semicolon being read.
+	return words[len(words)-1] != "END"
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func runREPL(s *store.Store, cfg sqlConfig) error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return fmt.Errorf("setting up terminal: %w", err)
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state) //nolint:errcheck
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "te> ")
+	history := historyPath()
+	mode := "read-only"
+	if cfg.write {
+		mode = "read-write"
+	}
+	fmt.Fprintf(t, "Connected to %s (%s). Type .help for help.\n", cfg.dbPath, mode)
+
+	format := cfg.format
+	var stmt strings.Builder
+	for {
+		line, err := t.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading input: %w", err)
+		}
+
+		if stmt.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ".") {
+			quit, err := sqlCommand(s, t, &format, history, strings.Fields(line))
+			if err != nil {
+				fmt.Fprintf(t, "Error: %v\n", err)
+			}
+			if quit {
+				return nil
+			}
+			continue
+		}
+
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if !complete(stmt.String()) {
+			if strings.TrimSpace(stmt.String()) != "" {
+				t.SetPrompt("...> ")
+			}
+			continue
+		}
+		query := stmt.String()
+		stmt.Reset()
+		t.SetPrompt("te> ")
+
+		if err := appendHistory(history, query); err != nil {
+			fmt.Fprintf(t, "Warning: %v\n", err)
+		}
+		if err := readOnlyHint(runStatement(s, format, t, query), cfg); err != nil {
+			fmt.Fprintf(t, "Error: %v\n", err)
+		}
+	}
+}
+
+// sqlCommand runs a REPL dot command and reports whether to exit.
+func sqlCommand(s *store.Store, out io.Writer, format *string, history string, args []string) (bool, error) {
+	switch args[0] {
+	case ".quit", ".exit":
+		return true, nil
+	case ".help":
+		fmt.Fprint(out, sqlHelp)
+	case ".mode":
+		if len(args) != 2 {
+			fmt.Fprintf(out, "Output format: %s\n", *format)
+			return false, nil
+		}
+		if _, err := newResultWriter(args[1], io.Discard); err != nil {
+			return false, err
+		}
+		*format = args[1]
+	case ".tables":
+		return false, runStatement(s, *format, out, `
+			SELECT name, type FROM sqlite_master
+			WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' AND name NOT LIKE 'elements_fts_%'
+			ORDER BY type, name`)
+	case ".schema":
+		query := "SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'elements_fts_%' ORDER BY name"
+		if len(args) > 1 {
+			query = "SELECT sql FROM sqlite_master WHERE name = ?"
+			return false, printSchema(s, out, query, args[1])
+		}
+		return false, printSchema(s, out, query)
+	case ".history":
+		n := 20
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return false, fmt.Errorf("history length must be a positive integer")
+			}
+		}
+		entries, err := readHistory(history)
+		if err != nil {
+			return false, err
+		}
+		start := max(len(entries)-n, 0)
+		for i := start; i < len(entries); i++ {
+			fmt.Fprintf(out, "%5d  %s\n", i+1, entries[i])
+		}
+	default:
+		return false, fmt.Errorf("unknown command %s (try .help)", args[0])
+	}
+	return false, nil
+}
+
+// printSchema writes each statement's SQL as it was written, rather than
+// as a table.
+func printSchema(s *store.Store, out io.Writer, query string, args ...interface{}) error {
+	w := &schemaWriter{out: out}
+	return s.SQL(w, query, args...)
+}
+
+type schemaWriter struct{ out io.Writer }
+
+func (w *schemaWriter) Columns([]string) error { return nil }
+
+func (w *schemaWriter) Row(values []interface{}) error {
+	_, err := fmt.Fprintf(w.out, "%s;\n", values[0])
+	return err
+}
+
+// historyPath is the file keeping REPL statements, beside the default
+// database.
+func historyPath() string {
+	return filepath.Join(filepath.Dir(store.DefaultPath()), "sql_history")
+}
+
+// appendHistory records a statement on one line, trimming the file to the
+// last historySize statements.
+func appendHistory(path, stmt string) error {
+	entries, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+	entries = append(entries, strings.Join(strings.Fields(stmt), " "))
+	if len(entries) > historySize {
+		entries = entries[len(entries)-historySize:]
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("saving history: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(entries, "\n")+"\n"), 0o600); err != nil {
+		return fmt.Errorf("saving history: %w", err)
+	}
+	return nil
+}
+
+func readHistory(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// resultWriter writes a statement's result in one output format.
+type resultWriter interface {
+	store.ResultWriter
+	Flush() error
+}
+
+func newResultWriter(format string, out io.Writer) (resultWriter, error) {
+	switch format {
+	case "table":
+		return &tableWriter{w: tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)}, nil
+	case "json":
+		return &jsonWriter{w: bufio.NewWriter(out)}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(out)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %q (want table, json or csv)", format)
+	}
+}
+
+// text renders a value for table and CSV output; NULL becomes null.
+func text(v interface{}, null string) string {
+	switch v := v.(type) {
+	case nil:
+		return null
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type tableWriter struct {
+	w *tabwriter.Writer
+}
+
+func (t *tableWriter) Columns(names []string) error {
+	_, err := fmt.Fprintln(t.w, strings.Join(names, "\t"))
+	return err
+}
+
+func (t *tableWriter) Row(values []interface{}) error {
+	cells := make([]string, len(values))
+	for i, v := range values {
+		// Tabs and newlines would break the table's columns.
+		cells[i] = strings.NewReplacer("\t", `\t`, "\n", `\n`).Replace(text(v, "NULL"))
+	}
+	_, err := fmt.Fprintln(t.w, strings.Join(cells, "\t"))
+	return err
+}
+
+func (t *tableWriter) Flush() error { return t.w.Flush() }
+
+// jsonWriter writes JSON Lines, one object per row with keys in column
+// order.
+type jsonWriter struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+func (j *jsonWriter) Columns(names []string) error {
+	j.columns = make([]string, len(names))
+	for i, name := range names {
+		key, err := marshalJSON(name)
+		if err != nil {
+			return err
+		}
+		j.columns[i] = key
+	}
+	return nil
+}
+
+func (j *jsonWriter) Row(values []interface{}) error {
+	fmt.Fprint(j.w, "{")
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		value, err := marshalJSON(v)
+		if err != nil {
+			return fmt.Errorf("encoding %s: %w", j.columns[i], err)
+		}
+		if i > 0 {
+			fmt.Fprint(j.w, ",")
+		}
+		fmt.Fprintf(j.w, "%s:%s", j.columns[i], value)
+	}
+	_, err := fmt.Fprintln(j.w, "}")
+	return err
+}
+
+func (j *jsonWriter) Flush() error { return j.w.Flush() }
+
+// marshalJSON encodes v without escaping <, > and &, which are common in
+// tariff text.
+func marshalJSON(v interface{}) (string, error) {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Columns(names []string) error { return c.w.Write(names) }
+
+func (c *csvWriter) Row(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = text(v, "")
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
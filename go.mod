@@ -7,6 +7,7 @@ require (
 	github.com/charmbracelet/bubbletea v1.3.0
 	github.com/charmbracelet/lipgloss v1.0.0
 	github.com/evertras/bubble-table v0.18.0
+	github.com/klauspost/compress v1.18.0
 	github.com/orisano/gosax v1.1.1
 	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211
 	modernc.org/sqlite v1.34.5
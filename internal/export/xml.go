@@ -0,0 +1,162 @@
+// Package export writes the contents of a store back out in other formats.
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/willfish/te/internal/parsing"
+	"github.com/willfish/te/internal/store"
+)
+
+// ErrNoElements is returned when there is nothing to export.
+var ErrNoElements = errors.New("no elements to export")
+
+const indent = "  "
+
+type containerKey struct {
+	importID, seq int64
+}
+
+// open is a container whose start tag has been written.
+type open struct {
+	id   string // identifies the container; roots are shared across imports
+	name string
+}
+
+// XML writes the elements in s as one XML document, rebuilding the envelope
+// around them from the stored containers. Records are written in document
+// order, import by import; records from later imports are placed in their
+// own copy of the envelope below a shared root element.
+//
+// Only elements parsed with their tree kept can be exported, and a database
+// holding documents with different root elements can't be written as one
+// document.
+func XML(w io.Writer, s *store.Store) error {
+	stored, err := s.Containers()
+	if err != nil {
+		return err
+	}
+	containers := make(map[containerKey]store.Container, len(stored))
+	for _, c := range stored {
+		containers[containerKey{c.ImportID, c.Seq}] = c
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, `<?xml version="1.0" encoding="UTF-8"?>`)
+
+	var stack []open
+	var root string // id of the root element, once written
+	written := 0
+	err = s.EachTree(func(t store.TreeRecord) error {
+		if t.Tree == "" {
+			return fmt.Errorf("element %s has no stored tree; parse it again to export it", t.Hjid)
+		}
+
+		chain, err := chainOf(containers, t)
+		if err != nil {
+			return err
+		}
+		common := 0
+		for common < len(stack) && common < len(chain) && stack[common].id == chain[common].id {
+			common++
+		}
+		for len(stack) > common {
+			closeTag(bw, len(stack)-1, stack[len(stack)-1].name)
+			stack = stack[:len(stack)-1]
+		}
+		for i := common; i < len(chain); i++ {
+			if i == 0 {
+				if root != "" {
+					return fmt.Errorf("element %s is under a different root element to earlier elements", t.Hjid)
+				}
+				root = chain[0].id
+			}
+			start, err := startTag(chain[i].tree)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(bw, "%s%s\n", strings.Repeat(indent, i), start)
+			stack = append(stack, open{id: chain[i].id, name: chain[i].name})
+		}
+		if len(stack) == 0 {
+			if root != "" {
+				return fmt.Errorf("element %s is outside any container, so can't share a document", t.Hjid)
+			}
+			root = t.Hjid
+		}
+
+		var el parsing.Element
+		if err := json.Unmarshal([]byte(t.Tree), &el); err != nil {
+			return fmt.Errorf("element %s: %w", t.Hjid, err)
+		}
+		prefix := strings.Repeat(indent, len(stack))
+		fmt.Fprint(bw, prefix)
+		if err := el.WriteXML(bw, prefix, indent); err != nil {
+			return fmt.Errorf("writing XML: %w", err)
+		}
+		fmt.Fprintln(bw)
+		written++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if written == 0 {
+		return ErrNoElements
+	}
+	for len(stack) > 0 {
+		closeTag(bw, len(stack)-1, stack[len(stack)-1].name)
+		stack = stack[:len(stack)-1]
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writing XML: %w", err)
+	}
+	return nil
+}
+
+type link struct {
+	id, name, tree string
+}
+
+// chainOf returns the containers around t, outermost first.
+func chainOf(containers map[containerKey]store.Container, t store.TreeRecord) ([]link, error) {
+	var chain []link
+	for seq := t.Container; seq != 0; {
+		c, ok := containers[containerKey{t.ImportID, seq}]
+		if !ok {
+			return nil, fmt.Errorf("element %s: container %d of import %d not found", t.Hjid, seq, t.ImportID)
+		}
+		id := fmt.Sprintf("%d/%d", t.ImportID, c.Seq)
+		if c.Parent == 0 {
+			// Roots with the same tag are written once for every import.
+			id = c.Tree
+		}
+		chain = append(chain, link{id: id, name: c.Name, tree: c.Tree})
+		seq = c.Parent
+		if len(chain) > len(containers) {
+			return nil, fmt.Errorf("element %s: containers of import %d form a cycle", t.Hjid, t.ImportID)
+		}
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+func startTag(tree string) (string, error) {
+	var el parsing.Element
+	if err := json.Unmarshal([]byte(tree), &el); err != nil {
+		return "", fmt.Errorf("container: %w", err)
+	}
+	return el.StartTag(), nil
+}
+
+func closeTag(w *bufio.Writer, depth int, name string) {
+	fmt.Fprintf(w, "%s</%s>\n", strings.Repeat(indent, depth), name)
+}
@@ -0,0 +1,230 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/willfish/te/internal/parsing"
+	"github.com/willfish/te/internal/store"
+)
+
+const envelopeXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="urn:envelope" id="e1">
+  <env:Body>
+    <Records batch="1">
+      <Measure xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="MeasureType">
+        <hjid>1</hjid>
+        <description lang="en">Frozen &amp; chilled &lt;fish&gt;</description>
+        <geographicalArea areaId="1011" note="a &quot;quoted&quot; &amp; tabbed&#x9;value">
+          <sid>400</sid>
+        </geographicalArea>
+        <component><sid>1</sid></component>
+        <component><sid>2</sid></component>
+        <flag enabled="true"/>
+        <empty/>
+      </Measure>
+      <Footnote>
+        <hjid>2</hjid>
+        <text>line one
+line two</text>
+        <metainfo><opType>C</opType></metainfo>
+      </Footnote>
+    </Records>
+    <Records batch="2">
+      <Measure>
+        <hjid>3</hjid>
+        <mixed>before <b>bold</b> after</mixed>
+      </Measure>
+    </Records>
+  </env:Body>
+</env:Envelope>
+`
+
+func openStore(t *testing.T) *store.Store {
+	t.Helper()
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func load(t *testing.T, doc string) *store.Store {
+	t.Helper()
+	return loadWith(t, doc, parsing.Options{})
+}
+
+func loadWith(t *testing.T, doc string, opts parsing.Options) *store.Store {
+	t.Helper()
+	s := openStore(t)
+	if _, err := s.BeginImport("doc.xml", int64(len(doc))); err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	if err := parsing.Parse(context.Background(), strings.NewReader(doc), s, opts); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := s.FinishImport(""); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+	return s
+}
+
+func exportXML(t *testing.T, s *store.Store) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := XML(&b, s); err != nil {
+		t.Fatalf("XML: %v", err)
+	}
+	return b.String()
+}
+
+type snapshot struct {
+	typ, data, tree string
+	seq, container  int64
+}
+
+func snapshotOf(t *testing.T, s *store.Store) map[string]snapshot {
+	t.Helper()
+	got := map[string]snapshot{}
+	err := s.EachTree(func(tr store.TreeRecord) error {
+		e, err := s.Element(tr.Hjid)
+		if err != nil {
+			return err
+		}
+		got[tr.Hjid] = snapshot{tr.Type, e.Data, tr.Tree, tr.Seq, tr.Container}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachTree: %v", err)
+	}
+	return got
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	first := load(t, envelopeXML)
+	exported := exportXML(t, first)
+
+	second := load(t, exported)
+	want, got := snapshotOf(t, first), snapshotOf(t, second)
+	if len(want) != 3 {
+		t.Fatalf("parsed %d elements, want 3", len(want))
+	}
+	for hjid, w := range want {
+		if g, ok := got[hjid]; !ok {
+			t.Errorf("element %s missing after round trip", hjid)
+		} else if g != w {
+			t.Errorf("element %s changed in round trip:\n got %+v\nwant %+v", hjid, g, w)
+		}
+	}
+
+	if again := exportXML(t, second); again != exported {
+		t.Errorf("second export differs from first:\n%s\n---\n%s", again, exported)
+	}
+
+	for _, s := range []string{
+		`<env:Envelope xmlns:env="urn:envelope" id="e1">`,
+		`<Records batch="2">`,
+		`<description lang="en">Frozen &amp; chilled &lt;fish&gt;</description>`,
+		`note="a &quot;quoted&quot; &amp; tabbed&#x9;value"`,
+		`<mixed>before <b>bold</b> after</mixed>`,
+	} {
+		if !strings.Contains(exported, s) {
+			t.Errorf("export lacks %s:\n%s", s, exported)
+		}
+	}
+}
+
+func TestXMLAppendedImportsShareRoot(t *testing.T) {
+	s := load(t, envelopeXML)
+	delta := `<env:Envelope xmlns:env="urn:envelope" id="e1"><env:Body><Records batch="3">
+<Measure><hjid>4</hjid></Measure>
+</Records></env:Body></env:Envelope>`
+	if _, err := s.BeginImport("delta.xml", int64(len(delta))); err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	if err := parsing.Parse(context.Background(), strings.NewReader(delta), s, parsing.Options{}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := s.FinishImport(""); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+
+	exported := exportXML(t, s)
+	if n := strings.Count(exported, "<env:Envelope"); n != 1 {
+		t.Errorf("export has %d roots, want 1:\n%s", n, exported)
+	}
+	if n := strings.Count(exported, "<env:Body>"); n != 2 {
+		t.Errorf("export has %d bodies, want one per import:\n%s", n, exported)
+	}
+	if len(snapshotOf(t, load(t, exported))) != 4 {
+		t.Errorf("re-parsed export lacks elements:\n%s", exported)
+	}
+}
+
+func TestXMLSplitChildren(t *testing.T) {
+	doc := `<a><b>
+<Measure><hjid>1</hjid><metainfo><opType>C</opType></metainfo>
+<measureComponent><hjid>11</hjid><metainfo><opType>C</opType></metainfo></measureComponent>
+</Measure>
+</b></a>`
+	exported := exportXML(t, loadWith(t, doc, parsing.Options{SplitChildren: true}))
+	if n := strings.Count(exported, "<measureComponent>"); n != 1 {
+		t.Errorf("export has %d components, want 1 inside its measure:\n%s", n, exported)
+	}
+}
+
+func TestXMLCData(t *testing.T) {
+	doc := `<a><b><c>
+<Footnote><hjid>1</hjid><desc><![CDATA[x < y & z]]></desc><note>a <![CDATA[<b>]]> c</note></Footnote>
+</c></b></a>`
+	first := load(t, doc)
+	e, err := first.Element("1")
+	if err != nil {
+		t.Fatalf("Element: %v", err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(e.Data), &data); err != nil {
+		t.Fatalf("decoding data: %v", err)
+	}
+	if data["desc"] != "x < y & z" || data["note"] != "a <b> c" {
+		t.Errorf("data = %s, want the CDATA text unescaped", e.Data)
+	}
+
+	exported := exportXML(t, first)
+	for _, s := range []string{
+		`<desc>x &lt; y &amp; z</desc>`,
+		`<note>a &lt;b&gt; c</note>`,
+	} {
+		if !strings.Contains(exported, s) {
+			t.Errorf("export lacks %s:\n%s", s, exported)
+		}
+	}
+	if got, want := snapshotOf(t, load(t, exported)), snapshotOf(t, first); got["1"] != want["1"] {
+		t.Errorf("element changed in round trip:\n got %+v\nwant %+v", got["1"], want["1"])
+	}
+}
+
+func TestXMLRequiresTrees(t *testing.T) {
+	s := openStore(t)
+	if err := s.InsertElement("1", "Measure", `{"hjid":"1"}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := XML(&bytes.Buffer{}, s); err == nil || !strings.Contains(err.Error(), "no stored tree") {
+		t.Errorf("XML = %v, want missing tree error", err)
+	}
+}
+
+func TestXMLEmpty(t *testing.T) {
+	if err := XML(&bytes.Buffer{}, openStore(t)); !errors.Is(err, ErrNoElements) {
+		t.Errorf("XML = %v, want ErrNoElements", err)
+	}
+}
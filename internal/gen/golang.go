@@ -0,0 +1,236 @@
+// Package gen generates code for consumers of a store from the schema
+// inferred from its data.
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/willfish/te/internal/store"
+)
+
+// initialisms are words written in capitals in Go names.
+var initialisms = map[string]string{"id": "ID", "sid": "SID", "hjid": "HJID", "url": "URL", "uri": "URI"}
+
+// dateType is decoded from the dates and date-times in the data, which
+// time.Time can't read on its own.
+const dateType = `
+// Date is a date or date-time as the data holds it, such as 2024-01-31 or
+// 2024-01-31T00:00:00. Empty strings and nulls decode to the zero Date.
+type Date struct {
+	time.Time
+}
+
+var dateLayouts = []string{"2006-01-02", "2006-01-02T15:04:05", time.RFC3339Nano}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var s *string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == nil || *s == "" {
+		d.Time = time.Time{}
+		return nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, *s); err == nil {
+			d.Time = t
+			return nil
+		}
+	}
+	return fmt.Errorf("parsing date %q", *s)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	layout := "2006-01-02T15:04:05"
+	if d.Equal(d.Truncate(24 * time.Hour)) {
+		layout = "2006-01-02"
+	}
+	return json.Marshal(d.Format(layout))
+}
+`
+
+// Go writes a Go source file for package pkg declaring a struct for each
+// element type, with a field per path in its data. JSON tags match the
+// flattened keys, so a type's struct decodes its elements' data directly.
+// Fields whose values are all numbers, booleans or dates get those types,
+// decoding from the strings the data holds them as; fields missing from
+// some elements are pointers, or plain strings and raw JSON tagged
+// omitempty.
+func Go(w io.Writer, pkg string, schemas []store.TypeSchema) error {
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("invalid package name %q", pkg)
+	}
+
+	type field struct {
+		name, goType, tag string
+	}
+	type structType struct {
+		name   string
+		schema store.TypeSchema
+		fields []field
+	}
+
+	usesDate, usesRaw := false, false
+	// Names the file declares besides the structs.
+	taken := map[string]bool{"Date": true, "New": true}
+	var structs []structType
+	for _, ts := range schemas {
+		st := structType{name: unique(goName(ts.Type), taken), schema: ts}
+		fieldNames := map[string]bool{}
+		for _, f := range ts.Fields {
+			goType, asString := fieldType(f)
+			required := f.Required(ts.Elements)
+			switch {
+			case goType == "Date":
+				usesDate = true
+			case goType == "json.RawMessage":
+				usesRaw = true
+			}
+			if !required && goType != "string" && goType != "json.RawMessage" {
+				goType = "*" + goType
+			}
+
+			tag := f.Path
+			if !required {
+				tag += ",omitempty"
+			}
+			if asString {
+				tag += ",string"
+			}
+			st.fields = append(st.fields, field{
+				name:   unique(goName(f.Path), fieldNames),
+				goType: goType,
+				tag:    fmt.Sprintf("`json:%s`", strconv.Quote(tag)),
+			})
+		}
+		structs = append(structs, st)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by te gen go. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	switch {
+	case usesDate:
+		fmt.Fprint(&b, "import (\n\"encoding/json\"\n\"fmt\"\n\"time\"\n)\n")
+	case usesRaw:
+		fmt.Fprint(&b, "import \"encoding/json\"\n")
+	}
+
+	for _, st := range structs {
+		fmt.Fprintf(&b, "\n// %s is the data of a %s element, as inferred from %d stored element(s).\n",
+			st.name, st.schema.Type, st.schema.Elements)
+		fmt.Fprintf(&b, "type %s struct {\n", st.name)
+		for _, f := range st.fields {
+			fmt.Fprintf(&b, "%s %s %s\n", f.name, f.goType, f.tag)
+		}
+		fmt.Fprint(&b, "}\n")
+	}
+
+	fmt.Fprint(&b, "\n// New returns a value to decode the data of an element of the named type\n")
+	fmt.Fprint(&b, "// into, or nil for a type without a struct.\n")
+	fmt.Fprint(&b, "func New(elementType string) interface{} {\nswitch elementType {\n")
+	for _, st := range structs {
+		fmt.Fprintf(&b, "case %s:\nreturn &%s{}\n", strconv.Quote(st.schema.Type), st.name)
+	}
+	fmt.Fprint(&b, "}\nreturn nil\n}\n")
+
+	if usesDate {
+		b.WriteString(dateType)
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// fieldType chooses the Go type for a field, and whether its values are
+// held in the data as strings and so need the string tag option.
+func fieldType(f store.FieldSchema) (string, bool) {
+	var types []string
+	for _, t := range f.Types {
+		if t != "null" {
+			types = append(types, t)
+		}
+	}
+	// Mixed JSON types can't be decoded into one Go type.
+	if len(types) != 1 {
+		return "json.RawMessage", false
+	}
+
+	jsonType := types[0]
+	switch jsonType {
+	case "integer":
+		return "int64", false
+	case "number":
+		return "float64", false
+	case "boolean":
+		return "bool", false
+	case "object", "array":
+		return "json.RawMessage", false
+	}
+
+	switch f.Format {
+	case "integer":
+		return "int64", true
+	case "number":
+		return "float64", true
+	case "boolean":
+		return "bool", true
+	case "date", "date-time":
+		return "Date", false
+	}
+	return "string", false
+}
+
+// goName turns a type name or field path into an exported Go name, such as
+// GeographicalAreaSID for geographicalArea.sid.
+func goName(s string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if upper, ok := initialisms[strings.ToLower(word)]; ok {
+			b.WriteString(upper)
+			continue
+		}
+		// Trailing Id and Sid, as in areaId, are initialisms too.
+		if strings.HasSuffix(word, "Id") || strings.HasSuffix(word, "Sid") {
+			word = word[:len(word)-2] + "ID"
+		}
+		r := []rune(word)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+
+	name := b.String()
+	if name == "" {
+		return "Field"
+	}
+	if unicode.IsDigit([]rune(name)[0]) {
+		return "F" + name
+	}
+	return name
+}
+
+// unique returns name, or name with a number appended if it is taken, and
+// marks the result taken.
+func unique(name string, taken map[string]bool) string {
+	result := name
+	for i := 2; taken[result]; i++ {
+		result = name + strconv.Itoa(i)
+	}
+	taken[result] = true
+	return result
+}
@@ -0,0 +1,104 @@
+package gen
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/willfish/te/internal/store"
+)
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"sid":                            "SID",
+		"hjid":                           "HJID",
+		"geographicalArea.@areaId":       "GeographicalAreaAreaID",
+		"measureTypeSid":                 "MeasureTypeSID",
+		"measureComponent[0].dutyAmount": "MeasureComponent0DutyAmount",
+		"ns:Measure":                     "NsMeasure",
+		"__content__":                    "Content",
+		"1st":                            "F1st",
+		"@":                              "Field",
+	}
+	for in, want := range tests {
+		if got := goName(in); got != want {
+			t.Errorf("goName(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+var schemas = []store.TypeSchema{
+	{
+		Type:     "Measure",
+		Elements: 2,
+		Fields: []store.FieldSchema{
+			{Path: "hjid", Types: []string{"string"}, Present: 2, Format: "integer"},
+			{Path: "goodsNomenclature.code", Types: []string{"string"}, Present: 2},
+			{Path: "dutyAmount", Types: []string{"string"}, Present: 1, Format: "number"},
+			{Path: "validityStartDate", Types: []string{"string"}, Present: 2, Format: "date"},
+			{Path: "validityEndDate", Types: []string{"null", "string"}, Present: 2, Nulls: 1, Format: "date-time"},
+			{Path: "flag", Types: []string{"boolean"}, Present: 2},
+			{Path: "mixed", Types: []string{"integer", "string"}, Present: 2},
+			{Path: "measure.sid", Types: []string{"string"}, Present: 2},
+			{Path: "measureSid", Types: []string{"string"}, Present: 2},
+		},
+	},
+	{
+		Type:     "Date",
+		Elements: 1,
+		Fields:   []store.FieldSchema{{Path: "note", Types: []string{"string"}, Present: 1}},
+	},
+}
+
+func TestGo(t *testing.T) {
+	var b bytes.Buffer
+	if err := Go(&b, "tariff", schemas); err != nil {
+		t.Fatalf("Go: %v", err)
+	}
+	src := b.String()
+	if !strings.HasPrefix(src, "// Code generated by te gen go. DO NOT EDIT.\n") {
+		t.Errorf("generated code lacks the generated header:\n%s", src)
+	}
+
+	// Compare ignoring the alignment gofmt adds.
+	flat := strings.Join(strings.Fields(src), " ")
+	for _, want := range []string{
+		"HJID int64 `json:\"hjid,string\"`",
+		"GoodsNomenclatureCode string `json:\"goodsNomenclature.code\"`",
+		"DutyAmount *float64 `json:\"dutyAmount,omitempty,string\"`",
+		"ValidityStartDate Date `json:\"validityStartDate\"`",
+		"ValidityEndDate *Date `json:\"validityEndDate,omitempty\"`",
+		"Flag bool `json:\"flag\"`",
+		"Mixed json.RawMessage `json:\"mixed\"`",
+		"MeasureSID string `json:\"measure.sid\"`",
+		"MeasureSID2 string `json:\"measureSid\"`",
+		"type Date2 struct",
+		"case \"Date\": return &Date2{}",
+	} {
+		if !strings.Contains(flat, want) {
+			t.Errorf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+
+	// The code must compile.
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "tariff.go", src, 0)
+	if err != nil {
+		t.Fatalf("parsing generated code: %v", err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check("tariff", fset, []*ast.File{f}, nil); err != nil {
+		t.Errorf("type-checking generated code: %v\n%s", err, src)
+	}
+}
+
+func TestGoRejectsBadPackage(t *testing.T) {
+	if err := Go(&bytes.Buffer{}, "not-a-name", schemas); err == nil {
+		t.Error("expected an error for an invalid package name")
+	}
+}
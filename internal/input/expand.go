@@ -0,0 +1,114 @@
+package input
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// extensions lists the file types picked up when expanding a directory.
+var extensions = map[string]bool{
+	".xml": true,
+	".gz":  true,
+	".zip": true,
+	".zst": true,
+	".bz2": true,
+}
+
+var filenameDate = regexp.MustCompile(`(?:^|\D)(\d{4})-?(\d{2})-?(\d{2})(?:\D|$)`)
+
+// Expand resolves arguments into a list of files. Glob patterns are expanded
+// and directories are walked for XML and compressed files; stdin ("-") and
+// URLs are passed through. Each file appears once, in the order first found.
+func Expand(args []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+
+	for _, arg := range args {
+		if !IsLocal(arg) {
+			add(arg)
+			continue
+		}
+
+		matches := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			var err error
+			matches, err = filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("expanding %s: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+		}
+
+		for _, m := range matches {
+			fi, err := os.Stat(m)
+			if err != nil {
+				return nil, fmt.Errorf("opening file: %w", err)
+			}
+			if !fi.IsDir() {
+				add(m)
+				continue
+			}
+
+			err = filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() && extensions[strings.ToLower(filepath.Ext(path))] {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("walking %s: %w", m, err)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// FilenameDate returns the first date embedded in a file's base name as
+// YYYYMMDD, accepting both 20240131 and 2024-01-31 forms, or "" if there is
+// none.
+func FilenameDate(name string) string {
+	m := filenameDate.FindStringSubmatch(filepath.Base(name))
+	if m == nil {
+		return ""
+	}
+	return m[1] + m[2] + m[3]
+}
+
+// Sort orders files by a key, breaking ties by name. Files whose key is
+// empty sort first, so an undated base snapshot loads before its deltas.
+func Sort(files []string, key func(name string) (string, error)) error {
+	keys := make(map[string]string, len(files))
+	for _, f := range files {
+		k, err := key(f)
+		if err != nil {
+			return err
+		}
+		keys[f] = k
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		ki, kj := keys[files[i]], keys[files[j]]
+		if ki != kj {
+			return ki < kj
+		}
+		return files[i] < files[j]
+	})
+	return nil
+}
@@ -0,0 +1,338 @@
+// Package input opens XML sources for parsing: local files, stdin ("-") and
+// HTTP(S) URLs. It transparently decompresses gzip, zstd and bzip2 streams
+// and iterates over the XML entries of zip archives.
+package input
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// client fetches HTTP(S) sources. A server that won't connect or answer
+// fails the fetch; a body being read may take as long as it needs, and is
+// aborted only by cancelling the context.
+var client = newClient(30*time.Second, time.Minute)
+
+func newClient(connectTimeout, headerTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = headerTimeout
+	return &http.Client{Transport: transport}
+}
+
+type format int
+
+const (
+	formatPlain format = iota
+	formatGzip
+	formatZip
+	formatZstd
+	formatBzip2
+)
+
+var magic = []struct {
+	prefix []byte
+	format format
+}{
+	{[]byte{0x1f, 0x8b}, formatGzip},
+	{[]byte("PK\x03\x04"), formatZip},
+	{[]byte("PK\x05\x06"), formatZip}, // empty archive
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, formatZstd},
+	{[]byte("BZh"), formatBzip2},
+}
+
+// Input is an opened source holding one or more XML documents.
+type Input struct {
+	Name string
+	// Size is the number of bytes in the source as stored, before
+	// decompression, or -1 if unknown.
+	Size int64
+
+	src      io.ReadCloser
+	file     *os.File // set when the source supports random access
+	spooled  bool     // file is a temporary copy of a streamed zip
+	consumed atomic.Int64
+	format   format
+	buffered *bufio.Reader
+	entries  []*zip.File
+	next     int
+	current  *Document
+}
+
+// Document is a single decompressed XML document read from an Input.
+type Document struct {
+	Name string
+	// Size is the number of stored (compressed) bytes backing the
+	// document, or -1 if unknown.
+	Size int64
+
+	r     io.Reader
+	close func() error
+}
+
+func (d *Document) Read(p []byte) (int, error) {
+	return d.r.Read(p)
+}
+
+// IsRemote reports whether name is an HTTP(S) URL.
+func IsRemote(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// IsLocal reports whether name refers to a local file rather than stdin or
+// a URL.
+func IsLocal(name string) bool {
+	return name != "-" && !IsRemote(name)
+}
+
+// Open opens a local file, stdin ("-") or an HTTP(S) URL and detects its
+// format from its magic bytes. Size is -1 for stdin and for responses
+// without a Content-Length.
+func Open(name string) (*Input, error) {
+	return OpenContext(context.Background(), name)
+}
+
+// OpenContext is like Open, but aborts an HTTP(S) download when ctx is
+// cancelled.
+func OpenContext(ctx context.Context, name string) (*Input, error) {
+	switch {
+	case name == "-":
+		return newInput("stdin", io.NopCloser(os.Stdin), -1, nil)
+
+	case IsRemote(name):
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("fetching %s: %w", name, err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("fetching %s: %w", name, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("fetching %s: %s", name, resp.Status)
+		}
+		return newInput(name, resp.Body, resp.ContentLength, nil)
+
+	default:
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("opening file: %w", err)
+		}
+
+		fi, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("stating file: %w", err)
+		}
+		return newInput(name, f, fi.Size(), f)
+	}
+}
+
+func newInput(name string, src io.ReadCloser, size int64, file *os.File) (*Input, error) {
+	in := &Input{Name: name, Size: size, src: src, file: file}
+	in.buffered = bufio.NewReader(&countingReader{r: src, n: &in.consumed})
+	head, err := in.buffered.Peek(4)
+	if err != nil && err != io.EOF {
+		_ = in.Close()
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	in.format = detect(head)
+
+	if in.format == formatZip {
+		if err := in.openZip(); err != nil {
+			_ = in.Close()
+			return nil, err
+		}
+	}
+
+	return in, nil
+}
+
+func (in *Input) openZip() error {
+	if in.file == nil {
+		// Zip needs random access, so copy a streamed archive to disk.
+		if err := in.spool(); err != nil {
+			return err
+		}
+	}
+
+	zr, err := zip.NewReader(&countingReaderAt{r: in.file, n: &in.consumed}, in.Size)
+	if err != nil {
+		return fmt.Errorf("reading zip %s: %w", in.Name, err)
+	}
+	for _, e := range zr.File {
+		if !e.FileInfo().IsDir() && strings.EqualFold(path.Ext(e.Name), ".xml") {
+			in.entries = append(in.entries, e)
+		}
+	}
+	if len(in.entries) == 0 {
+		return fmt.Errorf("zip %s contains no XML entries", in.Name)
+	}
+
+	// Only count entry reads; the central directory is read with
+	// generous over-reads that would skew progress.
+	in.consumed.Store(0)
+	return nil
+}
+
+func (in *Input) spool() error {
+	f, err := os.CreateTemp("", "te-*.zip")
+	if err != nil {
+		return fmt.Errorf("spooling %s: %w", in.Name, err)
+	}
+	in.file = f
+	in.spooled = true
+
+	n, err := io.Copy(f, in.buffered)
+	if err != nil {
+		return fmt.Errorf("spooling %s: %w", in.Name, err)
+	}
+	in.Size = n
+	return nil
+}
+
+func detect(head []byte) format {
+	for _, m := range magic {
+		if bytes.HasPrefix(head, m.prefix) {
+			return m.format
+		}
+	}
+	return formatPlain
+}
+
+// Consumed returns the number of stored bytes read from the source so far.
+// It is safe to call from any goroutine.
+func (in *Input) Consumed() int64 {
+	return in.consumed.Load()
+}
+
+// Next returns the next document in the input, closing the previous one.
+// It returns io.EOF when there are no more documents.
+func (in *Input) Next() (*Document, error) {
+	if err := in.closeCurrent(); err != nil {
+		return nil, err
+	}
+
+	var doc *Document
+	var err error
+	switch in.format {
+	case formatZip:
+		if in.next >= len(in.entries) {
+			return nil, io.EOF
+		}
+		doc, err = in.openEntry(in.entries[in.next])
+	default:
+		if in.next > 0 {
+			return nil, io.EOF
+		}
+		doc, err = in.openStream()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	in.next++
+	in.current = doc
+	return doc, nil
+}
+
+func (in *Input) openStream() (*Document, error) {
+	doc := &Document{Name: in.Name, Size: in.Size, close: func() error { return nil }}
+
+	switch in.format {
+	case formatGzip:
+		zr, err := gzip.NewReader(in.buffered)
+		if err != nil {
+			return nil, fmt.Errorf("reading gzip %s: %w", in.Name, err)
+		}
+		doc.r, doc.close = zr, zr.Close
+	case formatZstd:
+		zr, err := zstd.NewReader(in.buffered)
+		if err != nil {
+			return nil, fmt.Errorf("reading zstd %s: %w", in.Name, err)
+		}
+		doc.r = zr
+		doc.close = func() error {
+			zr.Close()
+			return nil
+		}
+	case formatBzip2:
+		doc.r = bzip2.NewReader(in.buffered)
+	default:
+		doc.r = in.buffered
+	}
+
+	return doc, nil
+}
+
+func (in *Input) openEntry(e *zip.File) (*Document, error) {
+	rc, err := e.Open()
+	if err != nil {
+		return nil, fmt.Errorf("opening %s in %s: %w", e.Name, in.Name, err)
+	}
+
+	return &Document{
+		Name:  in.Name + ":" + e.Name,
+		Size:  int64(e.CompressedSize64),
+		r:     rc,
+		close: rc.Close,
+	}, nil
+}
+
+func (in *Input) closeCurrent() error {
+	if in.current == nil {
+		return nil
+	}
+	err := in.current.close()
+	in.current = nil
+	return err
+}
+
+func (in *Input) Close() error {
+	_ = in.closeCurrent()
+	err := in.src.Close()
+	if in.spooled {
+		_ = in.file.Close()
+		_ = os.Remove(in.file.Name())
+	}
+	return err
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+type countingReaderAt struct {
+	r io.ReaderAt
+	n *atomic.Int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n.Add(int64(n))
+	return n, err
+}
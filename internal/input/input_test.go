@@ -0,0 +1,295 @@
+package input
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const doc = `<a><b>1</b></a>`
+
+// bzip2Doc is doc compressed with bzip2 -9; the standard library can only
+// decompress bzip2.
+var bzip2Doc = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xa8, 0x6e,
+	0x79, 0xbb, 0x00, 0x00, 0x02, 0x99, 0x00, 0x00, 0x00, 0xa0, 0x05, 0x30,
+	0x00, 0x20, 0x00, 0x21, 0x29, 0xa6, 0x9e, 0xa0, 0xc0, 0x34, 0xa5, 0x82,
+	0x22, 0x93, 0xc5, 0xdc, 0x91, 0x4e, 0x14, 0x24, 0x2a, 0x1b, 0x9e, 0x6e,
+	0xc0,
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+	return path
+}
+
+func readAll(t *testing.T, in *Input) map[string]string {
+	t.Helper()
+	docs := map[string]string{}
+	for {
+		d, err := in.Next()
+		if err == io.EOF {
+			return docs
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		b, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatalf("reading %s: %v", d.Name, err)
+		}
+		docs[d.Name] = string(b)
+	}
+}
+
+func TestOpenStreams(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte(doc))
+	_ = zw.Close()
+
+	var zst bytes.Buffer
+	enc, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatalf("zstd writer: %v", err)
+	}
+	_, _ = enc.Write([]byte(doc))
+	_ = enc.Close()
+
+	tests := map[string][]byte{
+		"plain.xml":    []byte(doc),
+		"export.gz":    gz.Bytes(),
+		"export.zst":   zst.Bytes(),
+		"export.bz2":   bzip2Doc,
+		"misnamed.xml": gz.Bytes(),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := writeFile(t, name, data)
+			in, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer in.Close() //nolint:errcheck
+
+			docs := readAll(t, in)
+			if len(docs) != 1 || docs[path] != doc {
+				t.Errorf("unexpected documents: %v", docs)
+			}
+			if in.Consumed() != int64(len(data)) {
+				t.Errorf("expected %d bytes consumed, got %d", len(data), in.Consumed())
+			}
+		})
+	}
+}
+
+func TestOpenZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"one.xml", "readme.txt", "dir/two.XML"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip create: %v", err)
+		}
+		_, _ = w.Write([]byte(doc))
+	}
+	_ = zw.Close()
+
+	path := writeFile(t, "exports.zip", buf.Bytes())
+	in, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer in.Close() //nolint:errcheck
+
+	docs := readAll(t, in)
+	if len(docs) != 2 || docs[path+":one.xml"] != doc || docs[path+":dir/two.XML"] != doc {
+		t.Errorf("unexpected documents: %v", docs)
+	}
+	if in.Consumed() == 0 || in.Consumed() > in.Size {
+		t.Errorf("unexpected consumed count %d for %d byte archive", in.Consumed(), in.Size)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.xml", "b.xml.gz", "notes.txt", "sub/c.zip"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	files, err := Expand([]string{filepath.Join(dir, "*.xml"), dir})
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "a.xml"),
+		filepath.Join(dir, "b.xml.gz"),
+		filepath.Join(dir, "sub/c.zip"),
+	}
+	if len(files) != len(want) {
+		t.Fatalf("expected %v, got %v", want, files)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("file %d: expected %s, got %s", i, want[i], files[i])
+		}
+	}
+
+	if _, err := Expand([]string{filepath.Join(dir, "*.missing")}); err == nil {
+		t.Error("expected error for glob with no matches")
+	}
+}
+
+func TestSortByFilenameDate(t *testing.T) {
+	files := []string{
+		"exports/delta-2024-01-03.xml",
+		"exports/delta-20240102.xml.gz",
+		"exports/base.xml",
+		"exports/2024-01-02-extra.xml",
+	}
+	err := Sort(files, func(name string) (string, error) { return FilenameDate(name), nil })
+	if err != nil {
+		t.Fatalf("Sort: %v", err)
+	}
+
+	want := []string{
+		"exports/base.xml",
+		"exports/2024-01-02-extra.xml",
+		"exports/delta-20240102.xml.gz",
+		"exports/delta-2024-01-03.xml",
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("position %d: expected %s, got %s", i, want[i], files[i])
+		}
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte(doc))
+	_ = zw.Close()
+
+	var zipped bytes.Buffer
+	w := zip.NewWriter(&zipped)
+	f, _ := w.Create("one.xml")
+	_, _ = f.Write([]byte(doc))
+	_ = w.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/export.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(gz.Bytes())
+	})
+	mux.HandleFunc("/chunked.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush() // forces chunked encoding, so no Content-Length
+		_, _ = w.Write([]byte(doc))
+	})
+	mux.HandleFunc("/exports.zip", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(zipped.Bytes())
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		size int64
+		docs []string
+	}{
+		{"/export.xml.gz", int64(gz.Len()), []string{srv.URL + "/export.xml.gz"}},
+		{"/chunked.xml", -1, []string{srv.URL + "/chunked.xml"}},
+		{"/exports.zip", int64(zipped.Len()), []string{srv.URL + "/exports.zip:one.xml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			in, err := Open(srv.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer in.Close() //nolint:errcheck
+
+			if in.Size != tt.size {
+				t.Errorf("expected size %d, got %d", tt.size, in.Size)
+			}
+			docs := readAll(t, in)
+			if len(docs) != len(tt.docs) {
+				t.Fatalf("expected %d documents, got %v", len(tt.docs), docs)
+			}
+			for _, name := range tt.docs {
+				if docs[name] != doc {
+					t.Errorf("%s: unexpected content %q", name, docs[name])
+				}
+			}
+		})
+	}
+
+	if _, err := Open(srv.URL + "/missing.xml"); err == nil {
+		t.Error("expected error for 404 response")
+	}
+}
+
+func TestOpenURLTimesOutWaitingForHeaders(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	saved := client
+	client = newClient(time.Second, 50*time.Millisecond)
+	defer func() { client = saved }()
+
+	if _, err := Open(srv.URL + "/slow.xml"); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Open = %v, want a timeout error", err)
+	}
+}
+
+func TestOpenStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe: %v", err)
+	}
+	go func() {
+		_, _ = w.Write([]byte(doc))
+		_ = w.Close()
+	}()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	in, err := Open("-")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer in.Close() //nolint:errcheck
+
+	if in.Size != -1 {
+		t.Errorf("expected unknown size, got %d", in.Size)
+	}
+	docs := readAll(t, in)
+	if docs["stdin"] != doc {
+		t.Errorf("unexpected documents: %v", docs)
+	}
+}
@@ -0,0 +1,81 @@
+package parsing
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseError locates a failure in the input. Errors from reading the XML
+// point at the token that failed; errors from processing or storing a
+// record point at the record's start tag.
+type ParseError struct {
+	Line   int   // 1-based
+	Column int   // 1-based, in characters
+	Offset int64 // bytes from the start of the document
+	// Path is the element path at the failure, e.g. /Envelope/Body/Measure.
+	Path string
+	// Hjid is the hjid of the record being read or, before one has been
+	// reached, of the previous record.
+	Hjid string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "line %d, column %d (byte %d)", e.Line, e.Column, e.Offset)
+	if e.Path != "" {
+		fmt.Fprintf(&b, " in %s", e.Path)
+	}
+	if e.Hjid != "" {
+		fmt.Fprintf(&b, " (hjid %s)", e.Hjid)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// position tracks the line, column and byte offset of the start of the
+// next token.
+type position struct {
+	line   int
+	column int
+	offset int64
+}
+
+func startPosition() position {
+	return position{line: 1, column: 1}
+}
+
+// advance moves past b.
+func (p *position) advance(b []byte) {
+	p.offset += int64(len(b))
+	if n := bytes.Count(b, []byte{'\n'}); n > 0 {
+		p.line += n
+		p.column = 1
+		b = b[bytes.LastIndexByte(b, '\n')+1:]
+	}
+	p.column += utf8.RuneCount(b)
+}
+
+// errorAt returns a ParseError for err at p.
+func (p position) errorAt(path []string, hjid string, err error) *ParseError {
+	return &ParseError{
+		Line:   p.line,
+		Column: p.column,
+		Offset: p.offset,
+		Path:   "/" + strings.Join(path, "/"),
+		Hjid:   hjid,
+		Err:    err,
+	}
+}
+
+// wrap returns a copy of e reporting err.
+func (e ParseError) wrap(err error) *ParseError {
+	e.Err = err
+	return &e
+}
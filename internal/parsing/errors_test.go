@@ -0,0 +1,75 @@
+package parsing
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const malformedXML = `<a><b><c>
+  <Measure><hjid>1</hjid></Measure>
+  <Measure><hjid>2</hjid><x a=1/></Measure>
+</c></b></a>`
+
+func TestParseErrorLocation(t *testing.T) {
+	var sink CountingSink
+	err := Parse(context.Background(), strings.NewReader(malformedXML), &sink, Options{})
+
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a *ParseError, got %v", err)
+	}
+	want := ParseError{Line: 3, Column: 26, Offset: 71, Path: "/a/b/c/Measure/x", Hjid: "2"}
+	if pe.Line != want.Line || pe.Column != want.Column || pe.Offset != want.Offset ||
+		pe.Path != want.Path || pe.Hjid != want.Hjid {
+		t.Errorf("got %+v, want %+v", *pe, want)
+	}
+	if !strings.HasPrefix(pe.Error(), "line 3, column 26 (byte 71) in /a/b/c/Measure/x (hjid 2): ") {
+		t.Errorf("unexpected message: %s", pe.Error())
+	}
+}
+
+func TestParseErrorBeforeHjid(t *testing.T) {
+	// The failing record has no hjid yet, so the previous record's is given.
+	xml := "<a><b><c><Measure><hjid>7</hjid></Measure><Measure><!x></Measure></c></b></a>"
+	var sink CountingSink
+	err := Parse(context.Background(), strings.NewReader(xml), &sink, Options{})
+
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a *ParseError, got %v", err)
+	}
+	if pe.Hjid != "7" || pe.Path != "/a/b/c/Measure" || pe.Line != 1 || pe.Column != 52 {
+		t.Errorf("unexpected error location: %+v", *pe)
+	}
+}
+
+func TestParseErrorFromSink(t *testing.T) {
+	sink := &failingAfterSink{after: 1}
+	err := Parse(context.Background(), strings.NewReader(operationsXML), sink, Options{Workers: 4})
+
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a *ParseError, got %v", err)
+	}
+	if !errors.Is(err, errSinkFull) {
+		t.Errorf("expected the sink error to be wrapped, got %v", err)
+	}
+	// The second record's start tag.
+	if pe.Line != 3 || pe.Column != 3 || pe.Path != "/a/b/c/Measure" || pe.Hjid != "2" {
+		t.Errorf("unexpected error location: %+v", *pe)
+	}
+}
+
+func TestPositionAdvance(t *testing.T) {
+	p := startPosition()
+	p.advance([]byte("<a>héllo"))
+	if p.line != 1 || p.column != 9 || p.offset != 9 {
+		t.Errorf("after one line got %+v", p)
+	}
+	p.advance([]byte("\n  \n  <b/>"))
+	if p.line != 3 || p.column != 7 || p.offset != 19 {
+		t.Errorf("after newlines got %+v", p)
+	}
+}
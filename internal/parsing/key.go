@@ -0,0 +1,96 @@
+package parsing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrMissingKey is reported through Options.Warn when a record lacks
+	// the fields its key is built from and is keyed by its content instead.
+	ErrMissingKey = errors.New("record has no key")
+	// ErrKeyCollision is reported through Options.Warn when a record's key
+	// was already used by a different record in the same document.
+	ErrKeyCollision = errors.New("key collision")
+)
+
+// Key says how a record's primary key is built. The zero value keys records
+// by hjid.
+type Key struct {
+	// Fields are flattened field names, e.g. sid or geographicalArea.sid,
+	// whose values are joined to form the key.
+	Fields []string
+	// Hash keys every record by a hash of its content.
+	Hash bool
+}
+
+// ParseKey parses a key strategy: "hjid", "hash", a field name, or field
+// names joined by "+" for a composite key.
+func ParseKey(spec string) (Key, error) {
+	switch spec {
+	case "", "hjid":
+		return Key{}, nil
+	case "hash":
+		return Key{Hash: true}, nil
+	}
+
+	var k Key
+	for _, f := range strings.Split(spec, "+") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			return Key{}, fmt.Errorf("invalid key %q: empty field name", spec)
+		}
+		k.Fields = append(k.Fields, f)
+	}
+	return k, nil
+}
+
+func (k Key) String() string {
+	switch {
+	case k.Hash:
+		return "hash"
+	case len(k.Fields) > 0:
+		return strings.Join(k.Fields, "+")
+	default:
+		return "hjid"
+	}
+}
+
+// build returns the key for a flattened record of type typ whose JSON is
+// data. hjid keys are used as they are; other keys are prefixed with the
+// type, since fields like sid are only unique within a type. When the
+// fields are missing the record is keyed by its content and ok is false.
+func (k Key) build(typ string, n Node, data []byte) (key string, ok bool) {
+	if k.Hash {
+		return hashKey(typ, data), true
+	}
+	if len(k.Fields) == 0 {
+		if v := n["hjid"]; v != nil {
+			return fmt.Sprint(v), true
+		}
+		return hashKey(typ, data), false
+	}
+
+	values := make([]string, len(k.Fields))
+	for i, f := range k.Fields {
+		v := n[f]
+		if v == nil {
+			return hashKey(typ, data), false
+		}
+		values[i] = fmt.Sprint(v)
+	}
+	return typ + ":" + strings.Join(values, "/"), true
+}
+
+// hashKey keys a record by a hash of its type and content, so identical
+// records share a key.
+func hashKey(typ string, data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(typ))
+	h.Write([]byte{0})
+	h.Write(data)
+	return typ + ":sha256:" + hex.EncodeToString(h.Sum(nil))[:32]
+}
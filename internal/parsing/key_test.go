@@ -0,0 +1,136 @@
+package parsing
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/willfish/te/internal/store"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Key
+	}{
+		{"", Key{}},
+		{"hjid", Key{}},
+		{"hash", Key{Hash: true}},
+		{"sid", Key{Fields: []string{"sid"}}},
+		{"sid + geographicalArea.sid", Key{Fields: []string{"sid", "geographicalArea.sid"}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseKey(tt.spec)
+		if err != nil {
+			t.Errorf("ParseKey(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseKey(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+	if _, err := ParseKey("sid+"); err == nil {
+		t.Error("expected an error for an empty field name")
+	}
+}
+
+const unkeyedXML = `<a><b><c>
+  <Footnote><sid>1</sid><code>TN001</code></Footnote>
+  <Footnote><sid>2</sid><code>TN002</code></Footnote>
+  <Footnote><sid>1</sid><code>CD001</code><area><sid>9</sid></area></Footnote>
+  <Footnote><sid>2</sid><code>TN002</code></Footnote>
+</c></b></a>`
+
+// parseKeys parses xml with key, returning the stored keys in order and the
+// warnings raised.
+func parseKeys(t *testing.T, xml string, key Key) ([]string, []error) {
+	t.Helper()
+
+	var keys []string
+	var warnings []error
+	sink := &keySink{keys: &keys}
+	opts := Options{Key: key, Warn: func(err error) { warnings = append(warnings, err) }}
+	if err := Parse(context.Background(), strings.NewReader(xml), sink, opts); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return keys, warnings
+}
+
+func TestParseMissingHjid(t *testing.T) {
+	keys, warnings := parseKeys(t, unkeyedXML, Key{})
+
+	if len(keys) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(keys))
+	}
+	for _, k := range keys {
+		if strings.Contains(k, "<nil>") || !strings.HasPrefix(k, "Footnote:sha256:") {
+			t.Errorf("expected a content key, got %s", k)
+		}
+	}
+	if keys[0] == keys[1] || keys[0] == keys[2] {
+		t.Errorf("expected different records to get different keys: %v", keys)
+	}
+	if keys[1] != keys[3] {
+		t.Errorf("expected identical records to share a key: %v", keys)
+	}
+
+	if len(warnings) != 4 {
+		t.Fatalf("expected a warning per record, got %d", len(warnings))
+	}
+	var pe *ParseError
+	if !errors.Is(warnings[0], ErrMissingKey) || !errors.As(warnings[0], &pe) || pe.Line != 2 {
+		t.Errorf("unexpected warning: %v", warnings[0])
+	}
+}
+
+func TestParseKeyByField(t *testing.T) {
+	keys, warnings := parseKeys(t, unkeyedXML, Key{Fields: []string{"sid"}})
+
+	want := []string{"Footnote:1", "Footnote:2", "Footnote:1", "Footnote:2"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("got keys %v, want %v", keys, want)
+	}
+
+	// Only the third record reuses a key with different data.
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrKeyCollision) {
+		t.Fatalf("expected one collision, got %v", warnings)
+	}
+	var pe *ParseError
+	if !errors.As(warnings[0], &pe) || pe.Line != 4 {
+		t.Errorf("expected the collision on line 4, got %v", warnings[0])
+	}
+}
+
+func TestParseKeyComposite(t *testing.T) {
+	keys, warnings := parseKeys(t, unkeyedXML, Key{Fields: []string{"sid", "area.sid"}})
+
+	if keys[2] != "Footnote:1/9" {
+		t.Errorf("expected a composite key, got %s", keys[2])
+	}
+	// The other records have no area and fall back to content keys.
+	if !strings.HasPrefix(keys[0], "Footnote:sha256:") {
+		t.Errorf("expected a content key, got %s", keys[0])
+	}
+	if len(warnings) != 3 {
+		t.Errorf("expected 3 missing key warnings, got %v", warnings)
+	}
+}
+
+func TestParseKeyHash(t *testing.T) {
+	_, warnings := parseKeys(t, unkeyedXML, Key{Hash: true})
+	if len(warnings) != 0 {
+		t.Errorf("expected content keys never to warn, got %v", warnings)
+	}
+}
+
+type keySink struct {
+	CountingSink
+	keys *[]string
+}
+
+func (k *keySink) PutRecord(r store.Record) error {
+	*k.keys = append(*k.keys, r.Hjid)
+	return k.CountingSink.PutRecord(r)
+}
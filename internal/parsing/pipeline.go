@@ -0,0 +1,266 @@
+package parsing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/willfish/te/internal/store"
+)
+
+// queueSize bounds the number of records in flight between pipeline stages.
+const queueSize = 256
+
+// errStopped is returned to the tokeniser when a later stage has failed.
+var errStopped = errors.New("pipeline stopped")
+
+// Reasons a record is quarantined in lenient mode.
+const (
+	RejectMalformed = "malformed"
+	RejectDuplicate = "duplicate"
+	RejectMarshal   = "marshal"
+)
+
+type job struct {
+	parsed
+	out chan result // buffered so workers never block
+}
+
+type result struct {
+	rec    store.Record
+	delete bool
+	// fallback is set when the record lacked its key fields and was keyed
+	// by content instead.
+	fallback bool
+	// derived is set when the key isn't an hjid, so may collide.
+	derived bool
+	// children are records split out of this one, written after it.
+	children []result
+	err      error
+}
+
+// runPipeline runs the three parse stages concurrently:
+//
+//  1. read calls emit for each record as it is tokenised, on the calling
+//     goroutine;
+//  2. a pool of workers flattens and marshals records in parallel;
+//  3. a single writer applies the results to s in the order they were
+//     emitted.
+//
+// s is flushed only once every stage has finished without error.
+//
+// Each job is queued for the writer before it is handed to a worker, so the
+// writer can wait on results in document order however the workers finish.
+// Cancelling ctx stops every stage without flushing s.
+func runPipeline(ctx context.Context, s Sink, opts Options, read func(emit emitFunc) error) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	jobs := make(chan job, queueSize)
+	ordered := make(chan job, queueSize)
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				j.out <- process(j.parsed, opts)
+			}
+		}()
+	}
+
+	writeErr := make(chan error, 1)
+	go func() {
+		err := write(ctx, s, opts, ordered)
+		if err != nil {
+			close(stop)
+		}
+		writeErr <- err
+	}()
+
+	skip := opts.Skip
+	readErr := read(func(p parsed) error {
+		if skip > 0 && p.container == nil {
+			skip--
+			return nil
+		}
+		j := job{parsed: p, out: make(chan result, 1)}
+		select {
+		case ordered <- j:
+		case <-stop:
+			return errStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if p.bad != nil || p.container != nil {
+			// Nothing to process; the writer handles it.
+			return nil
+		}
+		select {
+		case jobs <- j:
+		case <-stop:
+			return errStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	})
+
+	close(jobs)
+	close(ordered)
+	werr := <-writeErr
+	wg.Wait()
+
+	if werr != nil {
+		return werr
+	}
+	if readErr != nil {
+		return readErr
+	}
+	if err := s.Flush(); err != nil {
+		return fmt.Errorf("flushing store: %w", err)
+	}
+	return nil
+}
+
+// write drains ordered, writing each result to s. In lenient mode records
+// that can't be stored are quarantined instead.
+func write(ctx context.Context, s Sink, opts Options, ordered <-chan job) error {
+	// created holds hashes of the keys created so far, to find duplicates.
+	var created map[uint64]struct{}
+	seed := maphash.MakeSeed()
+	if opts.Lenient {
+		created = map[uint64]struct{}{}
+	}
+	// derived maps hashes of keys other than hjids to hashes of the data
+	// stored under them, to find collisions.
+	derived := map[uint64]uint64{}
+	warn := func(err error) {
+		if opts.Warn != nil {
+			opts.Warn(err)
+		}
+	}
+
+	// apply writes r and then its children to s.
+	var apply func(j job, r result) error
+	apply = func(j job, r result) error {
+		creates := r.rec.OpType == "" || r.rec.OpType == OpCreate
+		if created != nil && !r.fallback && creates {
+			h := maphash.String(seed, r.rec.Hjid)
+			if _, ok := created[h]; ok {
+				err := fmt.Errorf("element %s was already created in this document", r.rec.Hjid)
+				// A child is reported under its own hjid and type, with
+				// its parent's XML.
+				at, p := j.at.wrap(err), j.parsed
+				if r.rec.ParentHjid != "" {
+					at.Hjid, p.key = r.rec.Hjid, r.rec.Type
+				}
+				return quarantine(s, RejectDuplicate, at, p, r.rec.ParentHjid)
+			}
+			created[h] = struct{}{}
+		}
+		if r.fallback {
+			warn(j.at.wrap(fmt.Errorf("%w: keyed by content as %s", ErrMissingKey, r.rec.Hjid)))
+		}
+		if r.derived && creates {
+			k, d := maphash.String(seed, r.rec.Hjid), maphash.String(seed, r.rec.Data)
+			if prev, ok := derived[k]; ok && prev != d {
+				warn(j.at.wrap(fmt.Errorf("%w: %s is shared with an earlier record", ErrKeyCollision, r.rec.Hjid)))
+			}
+			derived[k] = d
+		}
+
+		if r.delete {
+			if err := s.DeleteRecord(r.rec); err != nil {
+				return j.at.wrap(fmt.Errorf("deleting element %s: %w", r.rec.Hjid, err))
+			}
+		} else if err := s.PutRecord(r.rec); err != nil {
+			return j.at.wrap(fmt.Errorf("inserting element %s: %w", r.rec.Hjid, err))
+		}
+		for _, c := range r.children {
+			if err := apply(j, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for j := range ordered {
+		if j.container != nil {
+			if err := s.PutContainer(*j.container); err != nil {
+				return fmt.Errorf("inserting container %s: %w", j.container.Name, err)
+			}
+			continue
+		}
+		if j.bad != nil {
+			if err := quarantine(s, RejectMalformed, j.bad, j.parsed, ""); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var r result
+		select {
+		case r = <-j.out:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if r.err != nil {
+			if !opts.Lenient {
+				return j.at.wrap(r.err)
+			}
+			if err := quarantine(s, RejectMarshal, j.at.wrap(r.err), j.parsed, ""); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := apply(j, r); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// quarantine passes a rejected record to s. parent is set when the record
+// is a child split out of the element with that hjid.
+func quarantine(s Sink, kind string, pe *ParseError, p parsed, parent string) error {
+	err := s.QuarantineRecord(store.BadRecord{
+		Kind:       kind,
+		Hjid:       pe.Hjid,
+		Type:       p.key,
+		Path:       pe.Path,
+		Line:       pe.Line,
+		Column:     pe.Column,
+		Offset:     pe.Offset,
+		Error:      pe.Err.Error(),
+		Fragment:   p.raw,
+		ParentHjid: parent,
+	})
+	if err != nil {
+		return p.at.wrap(fmt.Errorf("quarantining element %s: %w", pe.Hjid, err))
+	}
+	return nil
+}
+
+// contextReader fails reads once ctx is cancelled, so the tokeniser stops
+// between buffer fills even while no records are being emitted.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
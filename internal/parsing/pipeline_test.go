@@ -0,0 +1,370 @@
+package parsing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/willfish/te/internal/store"
+)
+
+// measuresXML returns a document holding n Measure records with distinct
+// hjids.
+func measuresXML(n int) string {
+	var doc strings.Builder
+	doc.WriteString("<a><b><c>\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&doc, `  <Measure><hjid>%d</hjid><metainfo><opType>C</opType>`+
+			`<transactionDate>2024-01-01T00:00:00</transactionDate></metainfo>`+
+			`<sid>%d</sid><geographicalArea areaId="1011"><sid>400</sid></geographicalArea>`+
+			`<footnote><code>TN%03d</code></footnote><footnote><code>CD%03d</code></footnote>`+
+			"</Measure>\n", i, i, i%1000, i%1000)
+	}
+	doc.WriteString("</c></b></a>\n")
+	return doc.String()
+}
+
+func TestParsePreservesOrder(t *testing.T) {
+	const n = 2000
+	var buf bytes.Buffer
+	sink := NewJSONLSink(&buf)
+	if err := Parse(context.Background(), strings.NewReader(measuresXML(n)), sink, Options{Workers: 8}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != n {
+		t.Fatalf("got %d records, want %d", len(lines), n)
+	}
+	for i, line := range lines {
+		var rec struct {
+			Hjid string `json:"hjid"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if want := fmt.Sprint(i); rec.Hjid != want {
+			t.Fatalf("record %d has hjid %s, want %s", i, rec.Hjid, want)
+		}
+	}
+}
+
+func TestParseApplyConcurrent(t *testing.T) {
+	// Deletes and updates must land after the creates they follow, however
+	// many workers process the records.
+	for _, workers := range []int{1, 8} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			s := parseString(t, operationsXML, Options{Apply: true, Workers: workers})
+
+			if _, err := s.Element("1"); err == nil {
+				t.Error("element 1 should have been deleted")
+			}
+			if got := elementData(t, s, "2")["sid"]; got != "201" {
+				t.Errorf("element 2 sid = %v, want 201", got)
+			}
+		})
+	}
+}
+
+type failingAfterSink struct {
+	CountingSink
+	after int
+}
+
+var errSinkFull = errors.New("sink full")
+
+func (f *failingAfterSink) PutRecord(r store.Record) error {
+	if f.Puts >= f.after {
+		return errSinkFull
+	}
+	return f.CountingSink.PutRecord(r)
+}
+
+func TestParseStopsOnSinkError(t *testing.T) {
+	sink := &failingAfterSink{after: 10}
+	err := Parse(context.Background(), strings.NewReader(measuresXML(5000)), sink, Options{Workers: 4})
+	if !errors.Is(err, errSinkFull) {
+		t.Fatalf("Parse error = %v, want %v", err, errSinkFull)
+	}
+	if sink.Puts != 10 {
+		t.Errorf("Puts = %d, want 10", sink.Puts)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestParseReportsReadError(t *testing.T) {
+	readErr := errors.New("connection reset")
+	r := io.MultiReader(strings.NewReader(measuresXML(100)[:2000]), errReader{readErr})
+
+	var sink CountingSink
+	if err := Parse(context.Background(), r, &sink, Options{Workers: 4}); !errors.Is(err, readErr) {
+		t.Fatalf("Parse error = %v, want %v", err, readErr)
+	}
+}
+
+// cancellingSink cancels a parse after a number of records and counts
+// flushes.
+type cancellingSink struct {
+	CountingSink
+	after   int
+	cancel  context.CancelFunc
+	flushes int
+}
+
+func (c *cancellingSink) PutRecord(r store.Record) error {
+	if c.Puts == c.after {
+		c.cancel()
+	}
+	return c.CountingSink.PutRecord(r)
+}
+
+func (c *cancellingSink) Flush() error {
+	c.flushes++
+	return nil
+}
+
+func TestParseCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sink := &cancellingSink{after: 10, cancel: cancel}
+	err := Parse(ctx, strings.NewReader(measuresXML(5000)), sink, Options{Workers: 4})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Parse error = %v, want %v", err, context.Canceled)
+	}
+	if sink.Puts >= 5000 {
+		t.Errorf("expected parsing to stop early, wrote %d records", sink.Puts)
+	}
+	if sink.flushes != 0 {
+		t.Errorf("expected a cancelled parse not to flush, got %d flushes", sink.flushes)
+	}
+}
+
+const lenientXML = `<a><b><c>
+  <Measure><hjid>1</hjid><metainfo><opType>C</opType></metainfo></Measure>
+  <Measure><hjid>2</hjid><x a=1/></Measure>
+  <Measure><hjid>1</hjid><metainfo><opType>C</opType></metainfo></Measure>
+  <Measure><hjid>3</hjid></Measure>
+  <Measure><hjid>1</hjid><metainfo><opType>U</opType></metainfo></Measure>
+</c></b></a>`
+
+type quarantineSink struct {
+	CountingSink
+	bad []store.BadRecord
+}
+
+func (q *quarantineSink) QuarantineRecord(b store.BadRecord) error {
+	q.bad = append(q.bad, b)
+	return q.CountingSink.QuarantineRecord(b)
+}
+
+func TestParseLenient(t *testing.T) {
+	sink := &quarantineSink{}
+	if err := Parse(context.Background(), strings.NewReader(lenientXML), sink, Options{Lenient: true, Workers: 4}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if sink.Puts != 3 || sink.Rejected != 2 {
+		t.Fatalf("expected 3 puts and 2 rejected, got %d and %d", sink.Puts, sink.Rejected)
+	}
+
+	malformed := store.BadRecord{
+		Kind: RejectMalformed, Hjid: "2", Type: "Measure", Path: "/a/b/c/Measure/x",
+		Line: 3, Column: 26, Offset: 110,
+		Error:    "reading attributes: invalid attribute value: 1",
+		Fragment: "<Measure><hjid>2</hjid><x a=1/></Measure>",
+	}
+	if sink.bad[0] != malformed {
+		t.Errorf("got %+v, want %+v", sink.bad[0], malformed)
+	}
+
+	dup := sink.bad[1]
+	if dup.Kind != RejectDuplicate || dup.Hjid != "1" || dup.Line != 4 || dup.Column != 3 ||
+		dup.Fragment != "<Measure><hjid>1</hjid><metainfo><opType>C</opType></metainfo></Measure>" {
+		t.Errorf("unexpected duplicate: %+v", dup)
+	}
+}
+
+func TestParseResumeAfterQuarantinedChild(t *testing.T) {
+	const measures = `<Measure><hjid>1</hjid><metainfo><opType>C</opType></metainfo>
+  <measureComponent><hjid>11</hjid><metainfo><opType>C</opType></metainfo></measureComponent>
+  <measureComponent><hjid>11</hjid><metainfo><opType>C</opType></metainfo></measureComponent>
+</Measure>
+<Measure><hjid>2</hjid><metainfo><opType>C</opType></metainfo></Measure>
+`
+	opts := Options{Lenient: true, SplitChildren: true, Apply: true}
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := store.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := s.BeginImport("doc.xml", -1); err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	s.SetCheckpointSource(func() (int64, string) { return 0, "" })
+	// The import stops after the first two records are committed.
+	if err := Parse(context.Background(), strings.NewReader("<a><b><c>"+measures+"</c></b></a>"), s, opts); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = store.OpenWith(path, store.OpenOptions{Append: true})
+	if err != nil {
+		t.Fatalf("OpenWith: %v", err)
+	}
+	defer func() { _ = s.Close() }()
+	im, err := s.LastImport("doc.xml")
+	if err != nil || im == nil {
+		t.Fatalf("LastImport = %+v, %v", im, err)
+	}
+	if im.Checkpoint.Records != 2 || im.Rejected != 1 {
+		t.Fatalf("checkpoint after a quarantined child: %+v, want 2 records and 1 rejected", im)
+	}
+
+	if err := s.ResumeImport(im); err != nil {
+		t.Fatalf("ResumeImport: %v", err)
+	}
+	full := "<a><b><c>" + measures + "<Measure><hjid>3</hjid><metainfo><opType>C</opType></metainfo></Measure>\n</c></b></a>"
+	opts.Skip = int(im.Checkpoint.Records)
+	if err := Parse(context.Background(), strings.NewReader(full), s, opts); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := s.FinishImport(""); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+	if _, err := s.Element("3"); err != nil {
+		t.Errorf("record after the checkpoint was skipped on resume: %v", err)
+	}
+}
+
+func TestParseStrictRejectsMalformed(t *testing.T) {
+	var sink CountingSink
+	err := Parse(context.Background(), strings.NewReader(lenientXML), &sink, Options{})
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 3 {
+		t.Fatalf("expected a ParseError on line 3, got %v", err)
+	}
+}
+
+// parseSerial parses like Parse without lenient mode or key checks, but
+// tokenises, processes and writes each record in turn on the calling
+// goroutine, with no channels, as a baseline for the pipeline.
+func parseSerial(f io.Reader, s Sink, opts Options) error {
+	sel := newSelector(opts)
+	if sel.depth == DepthAuto && !sel.byElement() {
+		depth, r, err := detectDepth(f)
+		if err != nil {
+			return err
+		}
+		sel.depth, f = depth, r
+	}
+
+	var apply func(r result) error
+	apply = func(r result) error {
+		if r.delete {
+			if err := s.DeleteRecord(r.rec); err != nil {
+				return err
+			}
+		} else if err := s.PutRecord(r.rec); err != nil {
+			return err
+		}
+		for _, c := range r.children {
+			if err := apply(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := tokenise(f, sel, opts, func(p parsed) error {
+		switch {
+		case p.container != nil:
+			return s.PutContainer(*p.container)
+		case p.bad != nil:
+			return p.bad
+		}
+		r := process(p, opts)
+		if r.err != nil {
+			return p.at.wrap(r.err)
+		}
+		return apply(r)
+	})
+	if err != nil {
+		return err
+	}
+	return s.Flush()
+}
+
+// BenchmarkParse compares worker counts with a serial baseline, writing
+// to a counting sink (pure parse throughput) and to a SQLite store.
+func BenchmarkParse(b *testing.B) {
+	data := measuresXML(1000)
+	workers := []int{1, 2, 4, 8}
+
+	b.Run("count/serial", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			var sink CountingSink
+			if err := parseSerial(strings.NewReader(data), &sink, Options{}); err != nil {
+				b.Fatalf("parseSerial: %v", err)
+			}
+		}
+	})
+	for _, w := range workers {
+		b.Run(fmt.Sprintf("count/workers=%d", w), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				var sink CountingSink
+				if err := Parse(context.Background(), strings.NewReader(data), &sink, Options{Workers: w}); err != nil {
+					b.Fatalf("Parse: %v", err)
+				}
+			}
+		})
+	}
+
+	b.Run("store/serial", func(b *testing.B) {
+		s, err := store.Open(filepath.Join(b.TempDir(), "bench.db"))
+		if err != nil {
+			b.Fatalf("opening store: %v", err)
+		}
+		defer s.Close() //nolint:errcheck
+
+		b.SetBytes(int64(len(data)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := parseSerial(strings.NewReader(data), s, Options{}); err != nil {
+				b.Fatalf("parseSerial: %v", err)
+			}
+		}
+	})
+	for _, w := range workers {
+		b.Run(fmt.Sprintf("store/workers=%d", w), func(b *testing.B) {
+			s, err := store.Open(filepath.Join(b.TempDir(), "bench.db"))
+			if err != nil {
+				b.Fatalf("opening store: %v", err)
+			}
+			defer s.Close() //nolint:errcheck
+
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := Parse(context.Background(), strings.NewReader(data), s, Options{Workers: w}); err != nil {
+					b.Fatalf("Parse: %v", err)
+				}
+			}
+		})
+	}
+}
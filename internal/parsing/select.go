@@ -0,0 +1,190 @@
+package parsing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/orisano/gosax"
+)
+
+const (
+	// DefaultDepth is the record depth of the standard tariff export envelope.
+	DefaultDepth = 4
+	// DepthAuto detects the record depth from the start of the document.
+	DepthAuto = -1
+
+	// detectLimit bounds how much of the input is buffered when detecting
+	// the record depth.
+	detectLimit = 4 << 20
+)
+
+// selector decides which elements are records.
+type selector struct {
+	depth int
+	paths [][]string
+	names []string
+}
+
+func newSelector(opts Options) selector {
+	sel := selector{depth: opts.Depth, names: opts.Names}
+	if sel.depth == 0 {
+		sel.depth = DefaultDepth
+	}
+	for _, p := range opts.Paths {
+		sel.paths = append(sel.paths, strings.Split(p, "/"))
+	}
+	return sel
+}
+
+// byElement reports whether records are chosen by path or name rather than
+// by depth.
+func (s selector) byElement() bool {
+	return len(s.paths) > 0 || len(s.names) > 0
+}
+
+func (s selector) match(depth int, path []string) bool {
+	if !s.byElement() {
+		return depth == s.depth
+	}
+	name := path[len(path)-1]
+	for _, n := range s.names {
+		if nameMatches(n, name) {
+			return true
+		}
+	}
+	for _, p := range s.paths {
+		if pathMatches(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathMatches matches a slash-separated selector against the current element
+// path. A leading slash anchors the selector at the document root; otherwise
+// it matches the trailing segments. "*" matches any single element.
+func pathMatches(sel, path []string) bool {
+	anchored := len(sel) > 0 && sel[0] == ""
+	if anchored {
+		sel = sel[1:]
+		if len(sel) != len(path) {
+			return false
+		}
+	}
+	if len(sel) > len(path) {
+		return false
+	}
+	path = path[len(path)-len(sel):]
+	for i, seg := range sel {
+		if seg != "*" && !nameMatches(seg, path[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// nameMatches compares a selector against an element name, ignoring the
+// namespace prefix unless the selector has one.
+func nameMatches(sel, name string) bool {
+	if sel == name {
+		return true
+	}
+	if strings.Contains(sel, ":") {
+		return false
+	}
+	return sel == localName(name)
+}
+
+func localName(name string) string {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// detectDepth buffers the start of r and finds the shallowest depth at which
+// a parent holds two or more same-named elements with children of their own.
+// It returns a reader that replays the buffered prefix followed by the rest
+// of r. When no repeating level is found DefaultDepth is returned.
+func detectDepth(r io.Reader) (int, io.Reader, error) {
+	prefix, err := io.ReadAll(io.LimitReader(r, detectLimit))
+	if err != nil {
+		return 0, nil, fmt.Errorf("reading input: %w", err)
+	}
+	replay := io.MultiReader(bytes.NewReader(prefix), r)
+
+	type level struct {
+		children map[string]int
+		complex  bool
+	}
+
+	found := 0
+	stack := []level{{children: map[string]int{}}}
+	xr := gosax.NewReader(bytes.NewReader(prefix))
+	xr.EmitSelfClosingTag = true
+	for {
+		e, err := xr.Event()
+		if err != nil || e.Type() == gosax.EventEOF {
+			// A truncated prefix is expected; use whatever was seen.
+			break
+		}
+		switch e.Type() {
+		case gosax.EventStart:
+			stack[len(stack)-1].complex = true
+			stack = append(stack, level{children: map[string]int{}})
+		case gosax.EventEnd:
+			if len(stack) < 2 {
+				continue
+			}
+			closed := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !closed.complex {
+				continue
+			}
+			name, _ := gosax.Name(e.Bytes)
+			parent := stack[len(stack)-1]
+			parent.children[string(name)]++
+			depth := len(stack)
+			if parent.children[string(name)] == 2 && (found == 0 || depth < found) {
+				found = depth
+			}
+		}
+	}
+
+	if found == 0 {
+		return DefaultDepth, replay, nil
+	}
+	return found, replay, nil
+}
+
+// FirstTransactionDate returns the text of the first transactionDate element
+// in r, or "" if there is none. It stops reading as soon as one is found.
+func FirstTransactionDate(r io.Reader) (string, error) {
+	xr := gosax.NewReader(r)
+	xr.EmitSelfClosingTag = true
+	inDate := false
+	var date []byte
+	for {
+		e, err := xr.Event()
+		if err != nil {
+			return "", fmt.Errorf("reading XML event: %w", err)
+		}
+		switch e.Type() {
+		case gosax.EventEOF:
+			return "", nil
+		case gosax.EventStart:
+			name, _ := gosax.Name(e.Bytes)
+			inDate = localName(string(name)) == "transactionDate"
+		case gosax.EventText:
+			if inDate {
+				date = append(date, e.Bytes...)
+			}
+		case gosax.EventEnd:
+			if inDate {
+				return strings.TrimSpace(string(date)), nil
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package parsing
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+const nestedXML = `<Root>
+  <Header><created>2024-01-01</created></Header>
+  <Batch>
+    <Measure><hjid>1</hjid><sid>100</sid></Measure>
+    <Group>
+      <Measure><hjid>2</hjid><sid>200</sid></Measure>
+    </Group>
+    <Footnote><hjid>3</hjid><code>TN001</code></Footnote>
+  </Batch>
+</Root>`
+
+func TestPathMatches(t *testing.T) {
+	tests := []struct {
+		sel  string
+		path []string
+		want bool
+	}{
+		{"/Root/Batch/Measure", []string{"Root", "Batch", "Measure"}, true},
+		{"/Root/Batch/Measure", []string{"Root", "Batch", "Group", "Measure"}, false},
+		{"Batch/Measure", []string{"Root", "Batch", "Measure"}, true},
+		{"Batch/Measure", []string{"Root", "Batch", "Group", "Measure"}, false},
+		{"Batch/*", []string{"Root", "Batch", "Footnote"}, true},
+		{"Measure", []string{"ns2:Measure"}, true},
+		{"ns1:Measure", []string{"ns2:Measure"}, false},
+		{"/Root/Batch", []string{"Root"}, false},
+	}
+	for _, tt := range tests {
+		if got := pathMatches(strings.Split(tt.sel, "/"), tt.path); got != tt.want {
+			t.Errorf("pathMatches(%q, %v) = %v, want %v", tt.sel, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseByName(t *testing.T) {
+	s := parseString(t, nestedXML, Options{Names: []string{"Measure"}})
+
+	count, err := s.ElementCount("Measure")
+	if err != nil {
+		t.Fatalf("ElementCount: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 measures at mixed depths, got %d", count)
+	}
+	if n, _ := s.ElementCount("Footnote"); n != 0 {
+		t.Errorf("expected footnotes to be ignored, got %d", n)
+	}
+}
+
+func TestParseByPath(t *testing.T) {
+	s := parseString(t, nestedXML, Options{Paths: []string{"/Root/Batch/*"}})
+
+	counts, err := s.TypeCounts()
+	if err != nil {
+		t.Fatalf("TypeCounts: %v", err)
+	}
+	got := map[string]int{}
+	for _, tc := range counts {
+		got[tc.Type] = tc.Count
+	}
+	if got["Measure"] != 1 || got["Footnote"] != 1 || got["Group"] != 1 {
+		t.Errorf("unexpected type counts: %v", got)
+	}
+}
+
+func TestParseByDepth(t *testing.T) {
+	s := parseString(t, nestedXML, Options{Depth: 3})
+
+	if n, _ := s.ElementCount("Measure"); n != 1 {
+		t.Errorf("expected 1 depth-3 measure, got %d", n)
+	}
+	if n, _ := s.ElementCount("Footnote"); n != 1 {
+		t.Errorf("expected 1 depth-3 footnote, got %d", n)
+	}
+}
+
+func TestDetectDepth(t *testing.T) {
+	doc := `<a><b><c><rec><hjid>1</hjid></rec><rec><hjid>2</hjid></rec></c></b></a>`
+	depth, r, err := detectDepth(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("detectDepth: %v", err)
+	}
+	if depth != 4 {
+		t.Errorf("expected depth 4, got %d", depth)
+	}
+
+	replayed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading replay: %v", err)
+	}
+	if string(replayed) != doc {
+		t.Errorf("replayed input differs from original")
+	}
+}
+
+func TestDetectDepthIgnoresRepeatsInsideRecords(t *testing.T) {
+	doc := `<a><rec><hjid>1</hjid><part><x>1</x></part><part><x>2</x></part></rec>` +
+		`<rec><hjid>2</hjid></rec></a>`
+	depth, _, err := detectDepth(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("detectDepth: %v", err)
+	}
+	if depth != 2 {
+		t.Errorf("expected depth 2, got %d", depth)
+	}
+}
+
+func TestParseAutoDepth(t *testing.T) {
+	doc := `<a><b><rec><hjid>1</hjid></rec><rec><hjid>2</hjid></rec></b></a>`
+	s := parseString(t, doc, Options{Depth: DepthAuto})
+
+	if n, _ := s.ElementCount("rec"); n != 2 {
+		t.Errorf("expected 2 records, got %d", n)
+	}
+}
+
+func TestFirstTransactionDate(t *testing.T) {
+	doc := `<a><b><rec><metainfo><opType>C</opType>` +
+		`<transactionDate>2024-01-02T10:00:00</transactionDate></metainfo></rec>` +
+		`<rec><metainfo><transactionDate>2023-01-01T00:00:00</transactionDate></metainfo></rec></b></a>`
+	date, err := FirstTransactionDate(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("FirstTransactionDate: %v", err)
+	}
+	if date != "2024-01-02T10:00:00" {
+		t.Errorf("unexpected date %q", date)
+	}
+
+	date, err = FirstTransactionDate(strings.NewReader(`<a><b/></a>`))
+	if err != nil || date != "" {
+		t.Errorf("expected no date, got %q, %v", date, err)
+	}
+}
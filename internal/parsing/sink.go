@@ -0,0 +1,213 @@
+package parsing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/willfish/te/internal/store"
+)
+
+// Sink receives the records produced by Parse. *store.Store is the primary
+// implementation.
+type Sink interface {
+	PutRecord(r store.Record) error
+	DeleteRecord(r store.Record) error
+	// QuarantineRecord receives records rejected in lenient mode.
+	QuarantineRecord(b store.BadRecord) error
+	// PutContainer receives each element enclosing records, before the
+	// first record inside it.
+	PutContainer(c store.Container) error
+	Flush() error
+	Close() error
+}
+
+var _ Sink = (*store.Store)(nil)
+
+// JSONLSink writes each record as a line of JSON.
+type JSONLSink struct {
+	w *bufio.Writer
+}
+
+type jsonlRecord struct {
+	Op              string          `json:"op"`
+	Hjid            string          `json:"hjid"`
+	Type            string          `json:"type"`
+	ParentHjid      string          `json:"parentHjid,omitempty"`
+	OpType          string          `json:"opType,omitempty"`
+	TransactionDate string          `json:"transactionDate,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+type jsonlBadRecord struct {
+	Op       string `json:"op"`
+	Kind     string `json:"kind"`
+	Hjid     string `json:"hjid,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Offset   int64  `json:"offset"`
+	Error    string `json:"error"`
+	Fragment string `json:"fragment"`
+}
+
+// NewJSONLSink returns a sink writing to w. Closing the sink flushes it but
+// does not close w.
+func NewJSONLSink(w io.Writer) *JSONLSink {
+	return &JSONLSink{w: bufio.NewWriter(w)}
+}
+
+func (j *JSONLSink) PutRecord(r store.Record) error {
+	return j.write("put", r)
+}
+
+func (j *JSONLSink) DeleteRecord(r store.Record) error {
+	return j.write("delete", r)
+}
+
+// QuarantineRecord writes a rejected record as an "error" line.
+func (j *JSONLSink) QuarantineRecord(b store.BadRecord) error {
+	return j.writeLine(jsonlBadRecord{
+		Op:       "error",
+		Kind:     b.Kind,
+		Hjid:     b.Hjid,
+		Type:     b.Type,
+		Path:     b.Path,
+		Line:     b.Line,
+		Column:   b.Column,
+		Offset:   b.Offset,
+		Error:    b.Error,
+		Fragment: b.Fragment,
+	})
+}
+
+// PutContainer does nothing; the JSON Lines output holds records only.
+func (j *JSONLSink) PutContainer(store.Container) error { return nil }
+
+func (j *JSONLSink) write(op string, r store.Record) error {
+	return j.writeLine(jsonlRecord{
+		Op:              op,
+		Hjid:            r.Hjid,
+		Type:            r.Type,
+		ParentHjid:      r.ParentHjid,
+		OpType:          r.OpType,
+		TransactionDate: r.TransactionDate,
+		Data:            json.RawMessage(r.Data),
+	})
+}
+
+func (j *JSONLSink) writeLine(v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding record: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := j.w.Write(line); err != nil {
+		return fmt.Errorf("writing record: %w", err)
+	}
+	return nil
+}
+
+func (j *JSONLSink) Flush() error {
+	return j.w.Flush()
+}
+
+func (j *JSONLSink) Close() error {
+	return j.w.Flush()
+}
+
+// CountingSink discards records, counting them and the bytes of data they
+// carry. It is useful for benchmarking the parser alone.
+type CountingSink struct {
+	Puts     int
+	Deletes  int
+	Rejected int
+	Bytes    int64
+}
+
+func (c *CountingSink) PutRecord(r store.Record) error {
+	c.Puts++
+	c.Bytes += int64(len(r.Data))
+	return nil
+}
+
+func (c *CountingSink) DeleteRecord(r store.Record) error {
+	c.Deletes++
+	c.Bytes += int64(len(r.Data))
+	return nil
+}
+
+func (c *CountingSink) QuarantineRecord(store.BadRecord) error {
+	c.Rejected++
+	return nil
+}
+
+func (c *CountingSink) PutContainer(store.Container) error { return nil }
+
+func (c *CountingSink) Flush() error { return nil }
+
+func (c *CountingSink) Close() error { return nil }
+
+// MultiSink writes every record to each of its sinks in order, stopping at
+// the first error.
+type MultiSink []Sink
+
+func (m MultiSink) PutRecord(r store.Record) error {
+	for _, s := range m {
+		if err := s.PutRecord(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiSink) DeleteRecord(r store.Record) error {
+	for _, s := range m {
+		if err := s.DeleteRecord(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiSink) QuarantineRecord(b store.BadRecord) error {
+	for _, s := range m {
+		if err := s.QuarantineRecord(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiSink) PutContainer(c store.Container) error {
+	for _, s := range m {
+		if err := s.PutContainer(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiSink) Flush() error {
+	for _, s := range m {
+		if err := s.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every sink, even if some fail, and returns their errors
+// joined.
+func (m MultiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,116 @@
+package parsing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/willfish/te/internal/store"
+)
+
+func TestJSONLSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLSink(&buf)
+
+	if err := Parse(context.Background(), strings.NewReader(operationsXML), sink, Options{Apply: true}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d:\n%s", len(lines), buf.String())
+	}
+
+	var rec struct {
+		Op     string                 `json:"op"`
+		Hjid   string                 `json:"hjid"`
+		Type   string                 `json:"type"`
+		OpType string                 `json:"opType"`
+		Data   map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &rec); err != nil {
+		t.Fatalf("decoding line: %v", err)
+	}
+	if rec.Op != "delete" || rec.Hjid != "1" || rec.Type != "Measure" || rec.OpType != OpDelete {
+		t.Errorf("unexpected delete record: %+v", rec)
+	}
+	if rec.Data["sid"] != "100" {
+		t.Errorf("expected data to be embedded as JSON, got %v", rec.Data)
+	}
+}
+
+func TestJSONLSinkQuarantine(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLSink(&buf)
+
+	if err := Parse(context.Background(), strings.NewReader(lenientXML), sink, Options{Lenient: true}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var bad struct {
+		Op       string `json:"op"`
+		Kind     string `json:"kind"`
+		Line     int    `json:"line"`
+		Fragment string `json:"fragment"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &bad); err != nil {
+		t.Fatalf("decoding line: %v", err)
+	}
+	if bad.Op != "error" || bad.Kind != RejectMalformed || bad.Line != 3 ||
+		bad.Fragment != "<Measure><hjid>2</hjid><x a=1/></Measure>" {
+		t.Errorf("unexpected error line: %+v", bad)
+	}
+}
+
+func TestCountingSink(t *testing.T) {
+	var sink CountingSink
+	if err := Parse(context.Background(), strings.NewReader(operationsXML), &sink, Options{Apply: true}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if sink.Puts != 3 || sink.Deletes != 1 || sink.Bytes == 0 {
+		t.Errorf("unexpected counts: %+v", sink)
+	}
+}
+
+type failingSink struct {
+	CountingSink
+	err error
+}
+
+func (f *failingSink) PutRecord(store.Record) error { return f.err }
+
+func (f *failingSink) Close() error { return f.err }
+
+func TestMultiSink(t *testing.T) {
+	var a, b CountingSink
+	multi := MultiSink{&a, &b}
+	if err := Parse(context.Background(), strings.NewReader(operationsXML), multi, Options{}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if a.Puts != 4 || b.Puts != 4 {
+		t.Errorf("expected both sinks to receive 4 records, got %d and %d", a.Puts, b.Puts)
+	}
+
+	boom := errors.New("boom")
+	var after CountingSink
+	multi = MultiSink{&failingSink{err: boom}, &after}
+	if err := multi.PutRecord(store.Record{Hjid: "1"}); !errors.Is(err, boom) {
+		t.Errorf("expected put error, got %v", err)
+	}
+	if after.Puts != 0 {
+		t.Error("expected fan-out to stop at the first error")
+	}
+	if err := multi.Close(); !errors.Is(err, boom) {
+		t.Errorf("expected close error, got %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package parsing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Element is an XML element as read, kept so records can be written back out
+// as XML. Children are *Element or string; text is kept as it appeared in
+// the source, still escaped, and CDATA sections are escaped into text.
+// Whitespace between elements, comments and processing instructions are
+// dropped.
+//
+// An Element marshals to JsonML: ["name", {"attr": "value"}, children...],
+// with the attribute object omitted when there are none. Call MarshalJSON
+// directly to avoid json.Marshal escaping HTML characters.
+type Element struct {
+	Name     string
+	Attrs    []Attr
+	Children []interface{}
+}
+
+// Attr is an attribute with its value unescaped.
+type Attr struct {
+	Name  string
+	Value string
+}
+
+func (e *Element) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	if err := e.marshal(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (e *Element) marshal(b *bytes.Buffer) error {
+	b.WriteByte('[')
+	writeJSONString(b, e.Name)
+	if len(e.Attrs) > 0 {
+		// Written by hand to keep the attributes in document order.
+		b.WriteString(",{")
+		for i, a := range e.Attrs {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeJSONString(b, a.Name)
+			b.WriteByte(':')
+			writeJSONString(b, a.Value)
+		}
+		b.WriteByte('}')
+	}
+	for _, c := range e.Children {
+		b.WriteByte(',')
+		switch c := c.(type) {
+		case string:
+			writeJSONString(b, c)
+		case *Element:
+			if err := c.marshal(b); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("element %s: unexpected child %T", e.Name, c)
+		}
+	}
+	b.WriteByte(']')
+	return nil
+}
+
+// writeJSONString writes s as a JSON string, escaped as encoding/json
+// escapes it except that <, > and & are left alone, since trees are mostly
+// escaped XML text. It writes straight to b, as trees hold many short
+// strings and an encoder for each one dominated the cost of marshalling.
+func writeJSONString(b *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	b.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b.WriteString(s[start:i])
+			switch c {
+			case '"', '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case '\n':
+				b.WriteString(`\n`)
+			case '\r':
+				b.WriteString(`\r`)
+			case '\t':
+				b.WriteString(`\t`)
+			default:
+				b.WriteString(`\u00`)
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteString(s[start:i])
+			b.WriteString(`\ufffd`)
+		case r == '\u2028' || r == '\u2029':
+			// Valid JSON, but not valid JavaScript.
+			b.WriteString(s[start:i])
+			b.WriteString(`\u202`)
+			b.WriteByte(hex[r&0xf])
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	b.WriteString(s[start:])
+	b.WriteByte('"')
+}
+
+func (e *Element) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := expectDelim(dec, '['); err != nil {
+		return fmt.Errorf("decoding element: %w", err)
+	}
+	if err := e.decode(dec); err != nil {
+		return fmt.Errorf("decoding element: %w", err)
+	}
+	return nil
+}
+
+// decode reads an element whose opening bracket has been consumed.
+func (e *Element) decode(dec *json.Decoder) error {
+	if err := dec.Decode(&e.Name); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'):
+			if len(e.Attrs) > 0 || len(e.Children) > 0 {
+				return fmt.Errorf("element %s: attributes must come first", e.Name)
+			}
+			for dec.More() {
+				var a Attr
+				if err := dec.Decode(&a.Name); err != nil {
+					return err
+				}
+				if err := dec.Decode(&a.Value); err != nil {
+					return err
+				}
+				e.Attrs = append(e.Attrs, a)
+			}
+			if err := expectDelim(dec, '}'); err != nil {
+				return err
+			}
+		case json.Delim('['):
+			child := &Element{}
+			if err := child.decode(dec); err != nil {
+				return err
+			}
+			e.Children = append(e.Children, child)
+		default:
+			text, ok := tok.(string)
+			if !ok {
+				return fmt.Errorf("element %s: unexpected %v", e.Name, tok)
+			}
+			e.Children = append(e.Children, text)
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("expected %v, got %v", want, tok)
+	}
+	return nil
+}
+
+// WriteXML writes e and its children as XML. Elements holding only other
+// elements are indented, one level per depth, starting at prefix; text is
+// written as it was read. Elements without children are self-closed.
+func (e *Element) WriteXML(w io.Writer, prefix, indent string) error {
+	var b strings.Builder
+	e.writeXML(&b, prefix, indent)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (e *Element) writeXML(b *strings.Builder, prefix, indent string) {
+	start := e.StartTag()
+	if len(e.Children) == 0 {
+		b.WriteString(start[:len(start)-1] + "/>")
+		return
+	}
+	b.WriteString(start)
+
+	nested := true
+	for _, c := range e.Children {
+		if _, ok := c.(string); ok {
+			nested = false
+		}
+	}
+	for _, c := range e.Children {
+		switch c := c.(type) {
+		case string:
+			b.WriteString(c)
+		case *Element:
+			if nested {
+				b.WriteString("\n" + prefix + indent)
+				c.writeXML(b, prefix+indent, indent)
+			} else {
+				c.writeXML(b, "", "")
+			}
+		}
+	}
+	if nested {
+		b.WriteString("\n" + prefix)
+	}
+	b.WriteString("</" + e.Name + ">")
+}
+
+// StartTag returns e's start tag, with its attributes.
+func (e *Element) StartTag() string {
+	var b strings.Builder
+	b.WriteString("<" + e.Name)
+	for _, a := range e.Attrs {
+		b.WriteString(" " + a.Name + `="`)
+		escapeAttr(&b, a.Value)
+		b.WriteByte('"')
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+var attrEscaper = strings.NewReplacer(
+	"&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;",
+	"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;",
+)
+
+func escapeAttr(b *strings.Builder, s string) {
+	_, _ = attrEscaper.WriteString(b, s)
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// escapeText escapes s for use as element text.
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
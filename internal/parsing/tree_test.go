@@ -0,0 +1,152 @@
+package parsing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/willfish/te/internal/store"
+)
+
+func TestElementJSON(t *testing.T) {
+	el := &Element{
+		Name:  "Measure",
+		Attrs: []Attr{{"z", "1"}, {"a", `"quoted" & <tagged>`}},
+		Children: []interface{}{
+			&Element{Name: "hjid", Children: []interface{}{"1"}},
+			&Element{Name: "empty"},
+			"tail &amp; more",
+		},
+	}
+
+	data, err := el.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `["Measure",{"z":"1","a":"\"quoted\" & <tagged>"},["hjid","1"],["empty"],"tail &amp; more"]`
+	if string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	var got Element
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(&got, el) {
+		t.Errorf("Unmarshal = %+v, want %+v", got, el)
+	}
+}
+
+func TestWriteJSONString(t *testing.T) {
+	for _, s := range []string{
+		"", "plain", `"quoted" \ slashed`, "tab\tline\nfeed\rbell\x07",
+		"caf\u00e9 \u2028 \u2029 \U0001f600", "bad \xff utf-8",
+	} {
+		var b bytes.Buffer
+		writeJSONString(&b, s)
+		var got string
+		if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+			t.Errorf("writeJSONString(%q) = %s, which doesn't decode: %v", s, b.String(), err)
+			continue
+		}
+		if want := strings.ToValidUTF8(s, "\ufffd"); got != want {
+			t.Errorf("writeJSONString(%q) decodes to %q, want %q", s, got, want)
+		}
+	}
+
+	var b bytes.Buffer
+	writeJSONString(&b, "<a & b>")
+	if b.String() != `"<a & b>"` {
+		t.Errorf("writeJSONString escaped HTML characters: %s", b.String())
+	}
+}
+
+func TestElementUnmarshalRejectsLateAttributes(t *testing.T) {
+	var el Element
+	if err := json.Unmarshal([]byte(`["a","text",{"b":"1"}]`), &el); err == nil {
+		t.Error("expected an error for attributes after children")
+	}
+}
+
+func TestElementWriteXML(t *testing.T) {
+	el := &Element{
+		Name:  "a",
+		Attrs: []Attr{{"note", "x\ty\"z"}},
+		Children: []interface{}{
+			&Element{Name: "b", Children: []interface{}{"1 &lt; 2"}},
+			&Element{Name: "c", Children: []interface{}{"x ", &Element{Name: "d"}, " y"}},
+			&Element{Name: "e"},
+		},
+	}
+
+	var b bytes.Buffer
+	if err := el.WriteXML(&b, "", "  "); err != nil {
+		t.Fatalf("WriteXML: %v", err)
+	}
+	want := `<a note="x&#x9;y&quot;z">
+  <b>1 &lt; 2</b>
+  <c>x <d/> y</c>
+  <e/>
+</a>`
+	if b.String() != want {
+		t.Errorf("WriteXML =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+type containerSink struct {
+	CountingSink
+	containers []store.Container
+	records    []store.Record
+}
+
+func (c *containerSink) PutContainer(ct store.Container) error {
+	c.containers = append(c.containers, ct)
+	return nil
+}
+
+func (c *containerSink) PutRecord(r store.Record) error {
+	c.records = append(c.records, r)
+	return nil
+}
+
+func TestParseKeepsTree(t *testing.T) {
+	s := &containerSink{}
+	if err := Parse(context.Background(), strings.NewReader(attributesXML), s, Options{}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	var names []string
+	for _, c := range s.containers {
+		names = append(names, c.Name)
+	}
+	if got := strings.Join(names, " "); got != "env:Envelope env:Body Records" {
+		t.Errorf("containers = %s", got)
+	}
+	for i, c := range s.containers {
+		if c.Seq != int64(i+1) || c.Parent != int64(i) {
+			t.Errorf("container %s: seq %d, parent %d", c.Name, c.Seq, c.Parent)
+		}
+	}
+	if want := `["env:Envelope",{"xmlns:env":"urn:envelope"}]`; s.containers[0].Tree != want {
+		t.Errorf("root tree = %s, want %s", s.containers[0].Tree, want)
+	}
+
+	if len(s.records) != 1 {
+		t.Fatalf("got %d records, want 1", len(s.records))
+	}
+	r := s.records[0]
+	if r.Seq != 1 || r.Container != 3 {
+		t.Errorf("record seq %d, container %d; want 1, 3", r.Seq, r.Container)
+	}
+	var tree Element
+	if err := json.Unmarshal([]byte(r.Tree), &tree); err != nil {
+		t.Fatalf("decoding tree: %v", err)
+	}
+	desc := tree.Children[1].(*Element)
+	if desc.Name != "description" || desc.Attrs[0] != (Attr{"lang", "en"}) || desc.Children[0] != "Frozen &amp; chilled" {
+		t.Errorf("description = %+v", desc)
+	}
+}
@@ -1,10 +1,14 @@
 package parsing
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/orisano/gosax"
 	"github.com/willfish/te/internal/store"
@@ -12,110 +16,576 @@ import (
 
 type Node map[string]interface{}
 
-func Parse(f io.Reader, s *store.Store) error {
-	targetDepth := 4
+const (
+	contentKey        = "__content__"
+	DefaultAttrPrefix = "@"
+)
+
+// Operation types carried in a record's metainfo block.
+const (
+	OpCreate = "C"
+	OpUpdate = "U"
+	OpDelete = "D"
+)
+
+// Options controls how Parse maps XML onto nodes.
+type Options struct {
+	// AttrPrefix is prepended to attribute names when they are stored on a
+	// node. It must not be a valid XML name start character so attributes
+	// can never collide with child elements. Defaults to DefaultAttrPrefix.
+	AttrPrefix string
+
+	// Depth selects records by nesting depth, counting the root element as
+	// 1. Zero means DefaultDepth and DepthAuto detects the repeating record
+	// level. Depth is ignored when Paths or Names are set.
+	Depth int
+
+	// Paths selects records by slash-separated element path, e.g.
+	// "/Envelope/Body/Measure" or "Body/*". See pathMatches.
+	Paths []string
+
+	// Names selects records by element name wherever they appear.
+	Names []string
+
+	// Workers is the number of goroutines flattening and marshalling
+	// records. Zero means GOMAXPROCS.
+	Workers int
+
+	// Apply honours each record's metainfo opType: deletes remove the
+	// stored element, creates and updates replace it. When false every
+	// record is stored regardless of its operation.
+	Apply bool
+
+	// Skip is the number of leading records to pass over without writing
+	// them, used to resume an interrupted import.
+	Skip int
+
+	// Lenient quarantines records that can't be stored, rather than
+	// failing: malformed records, duplicates of a record created earlier
+	// in the same document, and records that can't be marshalled. Each is
+	// passed to the sink's QuarantineRecord with its raw XML.
+	Lenient bool
+
+	// SplitChildren stores descendants of a record that have their own
+	// metainfo as records of their own, with the record's key as their
+	// ParentHjid, rather than leaving them embedded in its data.
+	SplitChildren bool
+
+	// Nested also stores each record's data before child elements were
+	// flattened, in store.Record's Nested.
+	Nested bool
+
+	// Key says how each record's primary key is built. Records missing
+	// the fields it names are keyed by a hash of their content.
+	Key Key
+
+	// Warn, if set, is called with a *ParseError wrapping ErrMissingKey
+	// for each record keyed by content because its key fields are
+	// missing, and wrapping ErrKeyCollision when a key other than hjid is
+	// reused by a different record. It is called from a single goroutine.
+	Warn func(err error)
+}
+
+func (o Options) attrPrefix() string {
+	if o.AttrPrefix == "" {
+		return DefaultAttrPrefix
+	}
+	return o.AttrPrefix
+}
+
+// Parse streams XML from f, writing each selected record to s. Tokenising,
+// record processing and sink writes run concurrently (see pipeline), but
+// records reach s in document order.
+//
+// s is flushed only if the whole input is parsed. If parsing fails, or ctx
+// is cancelled, Parse returns without flushing, leaving the caller to
+// discard or keep the unflushed writes. Failures are reported as a
+// *ParseError giving their location; cancellation wraps ctx.Err().
+func Parse(ctx context.Context, f io.Reader, s Sink, opts Options) error {
+	sel := newSelector(opts)
+	if sel.depth == DepthAuto && !sel.byElement() {
+		depth, r, err := detectDepth(f)
+		if err != nil {
+			return fmt.Errorf("detecting record depth: %w", err)
+		}
+		sel.depth = depth
+		f = r
+	}
+
+	f = &contextReader{ctx: ctx, r: f}
+	return runPipeline(ctx, s, opts, func(emit emitFunc) error {
+		return tokenise(f, sel, opts, emit)
+	})
+}
+
+// parsed is a record, or a container above records, as read by the
+// tokeniser.
+type parsed struct {
+	key  string
+	tree *Element
+	seq  int64 // the record's position in the document, from 1
+	// parent is the seq of the innermost container around the record.
+	parent int64
+	at     *ParseError // where the record starts, for reporting failures
+	// raw is the record's XML, captured only in lenient mode.
+	raw string
+	// bad is set, in lenient mode, when the record is malformed.
+	bad *ParseError
+	// container is set instead of a record for an element enclosing
+	// records, emitted before the first record inside it.
+	container *store.Container
+}
+
+// emitFunc receives each record as it is tokenised.
+type emitFunc func(p parsed) error
+
+// outer is an element above the records, tracked so the envelope can be
+// rebuilt on export.
+type outer struct {
+	el  *Element
+	seq int64 // 0 until a record is found inside it
+}
+
+// tokenise reads XML events from f, building an Element tree for each
+// selected record and passing it to emit once the record's end tag is
+// reached. Errors are returned as a *ParseError locating the failure.
+func tokenise(f io.Reader, sel selector, opts Options, emit emitFunc) error {
+	targetDepth := sel.depth
 	inTarget := false
 	extraContent := regexp.MustCompile(`^\n\s+`)
-	contentKey := "__content__"
-	stack := []Node{}
-	node := Node{}
+	stack := []*Element{}
+	outers := []outer{}
+	path := []string{}
+
+	pos := startPosition()
+	var recordStart, bad *ParseError
+	var raw []byte
+	var records, containers int64
+	recordHjid, lastHjid := "", ""
+	nearestHjid := func() string {
+		if inTarget && recordHjid != "" {
+			return recordHjid
+		}
+		return lastHjid
+	}
+	fail := func(err error) *ParseError {
+		return pos.errorAt(path, nearestHjid(), err)
+	}
 
 	depth := 0
+	selfClosing := false
 	r := gosax.NewReader(f)
+	r.EmitSelfClosingTag = true
 	for {
 		e, err := r.Event()
 		if err != nil {
-			return fmt.Errorf("reading XML event: %w", err)
+			return fail(fmt.Errorf("reading XML event: %w", err))
 		}
 		if e.Type() == gosax.EventEOF {
 			break
 		}
+		if opts.Lenient && inTarget && !selfClosing {
+			raw = append(raw, e.Bytes...)
+		}
 		switch e.Type() {
 		case gosax.EventStart:
 			depth++
+			name, _ := gosax.Name(e.Bytes)
+			path = append(path, string(name))
+
+			el := &Element{Name: string(name)}
+			attrs, err := readAttributes(e.Bytes)
+			el.Attrs = attrs
 
-			if depth == targetDepth {
+			if !inTarget && sel.match(depth, path) {
 				inTarget = true
+				targetDepth = depth
+				recordStart = pos.errorAt(path, lastHjid, nil)
+				recordHjid = ""
+				if opts.Lenient {
+					raw = append(raw[:0], e.Bytes...)
+				}
+
+				// Announce the containers this record is the first in.
+				for i := range outers {
+					if outers[i].seq != 0 {
+						continue
+					}
+					containers++
+					outers[i].seq = containers
+					c := &store.Container{Seq: containers, Name: outers[i].el.Name}
+					if i > 0 {
+						c.Parent = outers[i-1].seq
+					}
+					tree, err := outers[i].el.MarshalJSON()
+					if err != nil {
+						return fail(fmt.Errorf("marshalling container %s: %w", c.Name, err))
+					}
+					c.Tree = string(tree)
+					if err := emit(parsed{container: c}); err != nil {
+						return err
+					}
+				}
 			}
+
+			if err != nil {
+				err := fail(fmt.Errorf("reading attributes: %w", err))
+				if !opts.Lenient || !inTarget {
+					return err
+				}
+				if bad == nil {
+					bad = err
+				}
+			}
+
 			if inTarget {
 				if len(stack) > 0 {
-					lastNode := stack[len(stack)-1]
-					delete(lastNode, contentKey)
+					parent := stack[len(stack)-1]
+					parent.Children = append(parent.Children, el)
 				}
-				node = Node{contentKey: ""}
-				stack = append(stack, node)
+				stack = append(stack, el)
+			} else {
+				outers = append(outers, outer{el: el})
 			}
 		case gosax.EventText:
-			if inTarget {
-				if !extraContent.Match(e.Bytes) {
-					value := string(e.Bytes)
-					if len(value) > 0 {
-						if current, ok := node[contentKey].(string); ok {
-							node[contentKey] = current + value
-						} else {
-							node[contentKey] = value
-						}
+			if inTarget && len(e.Bytes) > 0 && !extraContent.Match(e.Bytes) {
+				el := stack[len(stack)-1]
+				text := string(e.Bytes)
+				// The tree keeps text escaped; check now that it unescapes,
+				// as buildNode will.
+				if _, err := unescapeText(text); err != nil {
+					err := fail(fmt.Errorf("reading text of %s: %w", el.Name, err))
+					if !opts.Lenient {
+						return err
+					}
+					if bad == nil {
+						bad = err
 					}
 				}
+				appendText(el, text)
 			}
-		case gosax.EventEnd:
-			key := string(e.Bytes)
-			if len(key) >= 3 {
-				key = key[2 : len(key)-1]
+		case gosax.EventCData:
+			if inTarget {
+				// Kept escaped like other text, so it reads back the same
+				// and export writes it as ordinary text.
+				text := bytes.TrimSuffix(bytes.TrimPrefix(e.Bytes, []byte("<![CDATA[")), []byte("]]>"))
+				appendText(stack[len(stack)-1], escapeText(string(text)))
 			}
+		case gosax.EventEnd:
+			if inTarget {
+				el := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if len(stack) == 1 && el.Name == "hjid" {
+					if hjid, ok := textContent(el); ok {
+						recordHjid = hjid
+					}
+				}
 
-			if depth == targetDepth {
-				n := stack[len(stack)-1]
-				targetHandler(n)
+				if depth == targetDepth {
+					records++
+					recordStart.Hjid = nearestHjid()
+					p := parsed{
+						key:  el.Name,
+						tree: el,
+						seq:  records,
+						at:   recordStart,
+						raw:  string(raw),
+						bad:  bad,
+					}
+					if len(outers) > 0 {
+						p.parent = outers[len(outers)-1].seq
+					}
+					if err := emit(p); err != nil {
+						return err
+					}
 
-				hjid := fmt.Sprintf("%v", n["hjid"])
-				jsonData, err := json.Marshal(n)
-				if err != nil {
-					return fmt.Errorf("marshalling element %s: %w", hjid, err)
+					lastHjid = recordStart.Hjid
+					bad = nil
+					inTarget = false
 				}
+			} else if len(outers) > 0 {
+				outers = outers[:len(outers)-1]
+			}
+			depth--
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
 
-				if err := s.InsertElement(hjid, key, string(jsonData)); err != nil {
-					return fmt.Errorf("inserting element %s: %w", hjid, err)
+		// A self-closing tag is reported as a start and an end event over
+		// the same bytes; only count them once.
+		if !selfClosing {
+			pos.advance(e.Bytes)
+		}
+		selfClosing = e.Type() == gosax.EventStart && bytes.HasSuffix(e.Bytes, []byte("/>"))
+	}
+
+	return nil
+}
+
+// appendText adds text to el, joining it to text already at the end.
+func appendText(el *Element, text string) {
+	if n := len(el.Children); n > 0 {
+		if prev, ok := el.Children[n-1].(string); ok {
+			el.Children[n-1] = prev + text
+			return
+		}
+	}
+	el.Children = append(el.Children, text)
+}
+
+// textContent returns an element's text if it has nothing else: no
+// attributes and no child elements.
+func textContent(el *Element) (string, bool) {
+	if len(el.Attrs) > 0 {
+		return "", false
+	}
+	var text string
+	for _, c := range el.Children {
+		s, ok := c.(string)
+		if !ok {
+			return "", false
+		}
+		text += s
+	}
+	return text, text != ""
+}
+
+// buildNode converts a record's Element tree to the Node that records have
+// always been stored as: text in __content__, attributes under prefix, and
+// repeated children as lists.
+func buildNode(root *Element, prefix string) Node {
+	var stack []Node
+	var node Node
+	var build func(el *Element)
+	build = func(el *Element) {
+		if len(stack) > 0 {
+			delete(stack[len(stack)-1], contentKey)
+		}
+		node = Node{contentKey: ""}
+		for _, a := range el.Attrs {
+			node[prefix+a.Name] = a.Value
+		}
+		stack = append(stack, node)
+
+		for _, c := range el.Children {
+			switch c := c.(type) {
+			case string:
+				// Text is checked as it's read, so always unescapes.
+				c, _ = unescapeText(c)
+				// Text after a child element lands on the most recently
+				// started node, as it always has.
+				if current, ok := node[contentKey].(string); ok {
+					node[contentKey] = current + c
+				} else {
+					node[contentKey] = c
 				}
+			case *Element:
+				build(c)
+			}
+		}
 
-				stack = stack[:len(stack)-1]
-				inTarget = false
+		dropEmptyContent(stack[len(stack)-1])
+		if len(stack) == 1 {
+			return
+		}
+		child := stack[len(stack)-1]
+		parent := stack[len(stack)-2]
+		stack = stack[:len(stack)-1]
+
+		switch v := parent[el.Name].(type) {
+		case []Node:
+			parent[el.Name] = append(v, child)
+		case Node:
+			parent[el.Name] = []Node{v, child}
+		default:
+			if content, ok := child[contentKey].(string); ok && len(child) == 1 && content != "" {
+				parent[el.Name] = content
+			} else {
+				parent[el.Name] = child
 			}
-			depth--
+		}
+	}
+	build(root)
+	return stack[0]
+}
 
-			if inTarget {
-				child := stack[len(stack)-1]
-				node := stack[len(stack)-2]
-				stack = stack[:len(stack)-1]
+// process flattens a record and converts it to a store.Record keyed as
+// opts.Key says, along with any children split out of it.
+func process(p parsed, opts Options) result {
+	r := buildRecord(p.key, buildNode(p.tree, opts.attrPrefix()), "", opts)
+	if r.err != nil {
+		return r
+	}
+	tree, err := p.tree.MarshalJSON()
+	if err != nil {
+		return result{err: fmt.Errorf("marshalling element %s: %w", r.rec.Hjid, err)}
+	}
+	r.rec.Tree = string(tree)
+	r.rec.Seq = p.seq
+	r.rec.Container = p.parent
+	return r
+}
 
-				switch v := node[key].(type) {
-				case []Node:
-					node[key] = append(v, child)
-				case Node:
-					node[key] = []Node{v, child}
-				default:
-					if len(child) == 1 && child[contentKey] != "" {
-						node[key] = child[contentKey]
-					} else {
-						node[key] = child
-					}
+// buildRecord flattens n into a record of type typ. With SplitChildren,
+// descendants carrying their own metainfo are built into records of their
+// own, returned as the result's children with parent set to n's key.
+func buildRecord(typ string, n Node, parent string, opts Options) result {
+	var nested []byte
+	if opts.Nested {
+		var err error
+		if nested, err = json.Marshal(n); err != nil {
+			return result{err: fmt.Errorf("marshalling element %v: %w", n["hjid"], err)}
+		}
+	}
+	var children []child
+	if opts.SplitChildren {
+		children = splitChildren(n)
+	}
+	flat := flatten(n)
+
+	jsonData, err := json.Marshal(flat)
+	if err != nil {
+		return result{err: fmt.Errorf("marshalling element %v: %w", n["hjid"], err)}
+	}
+
+	key, ok := opts.Key.build(typ, flat, jsonData)
+	rec := store.Record{
+		Hjid:            key,
+		Type:            typ,
+		Data:            string(jsonData),
+		Nested:          string(nested),
+		ParentHjid:      parent,
+		OpType:          metainfo(flat, "opType"),
+		TransactionDate: metainfo(flat, "transactionDate"),
+	}
+	r := result{
+		rec:      rec,
+		delete:   opts.Apply && rec.OpType == OpDelete,
+		fallback: !ok,
+		derived:  !ok || opts.Key.Hash || len(opts.Key.Fields) > 0,
+	}
+	for _, c := range children {
+		cr := buildRecord(c.key, c.node, key, opts)
+		if cr.err != nil {
+			return cr
+		}
+		r.children = append(r.children, cr)
+	}
+	return r
+}
+
+// child is a node split out of its record.
+type child struct {
+	key  string
+	node Node
+}
+
+// splitChildren removes the descendants of n that have their own metainfo,
+// looking through nodes without one, and returns them ordered by name.
+// Lists left empty are removed.
+func splitChildren(n Node) []child {
+	keys := make([]string, 0, len(n))
+	for k := range n {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var children []child
+	for _, k := range keys {
+		switch v := n[k].(type) {
+		case Node:
+			if v["metainfo"] != nil {
+				children = append(children, child{k, v})
+				delete(n, k)
+			} else {
+				children = append(children, splitChildren(v)...)
+			}
+		case []Node:
+			var kept []Node
+			for _, item := range v {
+				if item["metainfo"] != nil {
+					children = append(children, child{k, item})
+				} else {
+					children = append(children, splitChildren(item)...)
+					kept = append(kept, item)
 				}
 			}
+			if len(kept) == 0 {
+				delete(n, k)
+			} else {
+				n[k] = kept
+			}
 		}
 	}
+	return children
+}
 
-	if err := s.Flush(); err != nil {
-		return fmt.Errorf("flushing store: %w", err)
+// metainfo returns a field from a record's metainfo block, whether it has
+// been flattened or not.
+func metainfo(n Node, field string) string {
+	if v, ok := n["metainfo."+field].(string); ok {
+		return v
+	}
+	if m, ok := n["metainfo"].(Node); ok {
+		if v, ok := m[field].(string); ok {
+			return v
+		}
 	}
+	return ""
+}
 
-	return nil
+func readAttributes(tag []byte) ([]Attr, error) {
+	var attrs []Attr
+	_, b := gosax.Name(tag)
+	for len(b) > 0 {
+		attr, rest, err := gosax.NextAttribute(b)
+		if err != nil {
+			return attrs, err
+		}
+		if len(attr.Key) == 0 {
+			break
+		}
+		b = rest
+
+		var value []byte
+		if len(attr.Value) >= 2 {
+			value, err = gosax.Unescape(attr.Value[1 : len(attr.Value)-1])
+			if err != nil {
+				return attrs, fmt.Errorf("attribute %s: %w", attr.Key, err)
+			}
+		}
+		attrs = append(attrs, Attr{Name: string(attr.Key), Value: string(value)})
+	}
+	return attrs, nil
+}
+
+// unescapeText replaces the entity and character references in text read
+// from the source.
+func unescapeText(text string) (string, error) {
+	if !strings.Contains(text, "&") {
+		return text, nil
+	}
+	b, err := gosax.Unescape([]byte(text))
+	if err != nil {
+		return text, err
+	}
+	return string(b), nil
+}
+
+// dropEmptyContent removes the placeholder content key from nodes that carry
+// attributes or children, so attribute-only elements don't gain a spurious
+// empty text value.
+func dropEmptyContent(n Node) {
+	if len(n) > 1 && n[contentKey] == "" {
+		delete(n, contentKey)
+	}
 }
 
 func deepFlatten(n Node, prefix string) Node {
 	flattened := Node{}
 	for k, v := range n {
 		if v == nil {
-			delete(n, k)
 			continue
 		}
 
@@ -137,30 +607,29 @@ func deepFlatten(n Node, prefix string) Node {
 	return flattened
 }
 
-func targetHandler(n Node) Node {
+// flatten returns a copy of n with child elements that lack their own
+// metainfo flattened into dotted keys, leaving n as it was.
+func flatten(n Node) Node {
+	flat := make(Node, len(n))
 	for k, v := range n {
-		if v == nil {
-			continue
-		}
 		switch v := v.(type) {
 		case Node:
 			if v["metainfo"] == nil {
-				flattened := deepFlatten(v, k)
-				for kk, vv := range flattened {
-					n[kk] = vv
+				for kk, vv := range deepFlatten(v, k) {
+					flat[kk] = vv
 				}
-				delete(n, k)
 			} else {
-				n[k] = targetHandler(v)
+				flat[k] = flatten(v)
 			}
 		case []Node:
-			nodes := []Node{}
+			nodes := make([]Node, 0, len(v))
 			for _, n := range v {
-				nodes = append(nodes, targetHandler(n))
+				nodes = append(nodes, flatten(n))
 			}
-			n[k] = nodes
+			flat[k] = nodes
+		default:
+			flat[k] = v
 		}
 	}
-
-	return n
+	return flat
 }
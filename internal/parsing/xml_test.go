@@ -1,8 +1,11 @@
 package parsing
 
 import (
+	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/willfish/te/internal/store"
@@ -28,7 +31,7 @@ func TestParseXML(t *testing.T) {
 	}
 	defer s.Close() //nolint:errcheck
 
-	if err := Parse(f, s); err != nil {
+	if err := Parse(context.Background(), f, s, Options{}); err != nil {
 		t.Fatalf("Parse: %v", err)
 	}
 
@@ -95,3 +98,268 @@ func projectRoot(t *testing.T) string {
 		dir = parent
 	}
 }
+
+const attributesXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="urn:envelope">
+  <env:Body>
+    <Records>
+      <Measure xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="MeasureType">
+        <hjid>1</hjid>
+        <description lang="en">Frozen &amp; chilled</description>
+        <geographicalArea areaId="1011">
+          <sid>400</sid>
+        </geographicalArea>
+        <flag enabled="true"/>
+        <wrapper><inner>x</inner></wrapper>
+        <empty/>
+      </Measure>
+    </Records>
+  </env:Body>
+</env:Envelope>
+`
+
+func TestParseAttributes(t *testing.T) {
+	s := parseString(t, attributesXML, Options{})
+	n := elementData(t, s, "1")
+
+	want := map[string]interface{}{
+		"@xmlns:xsi":               "http://www.w3.org/2001/XMLSchema-instance",
+		"@xsi:type":                "MeasureType",
+		"hjid":                     "1",
+		"description.@lang":        "en",
+		"description.__content__":  "Frozen & chilled",
+		"geographicalArea.@areaId": "1011",
+		"geographicalArea.sid":     "400",
+		"flag.@enabled":            "true",
+		"empty.__content__":        "",
+		"wrapper.inner":            "x",
+	}
+	for k, v := range want {
+		if n[k] != v {
+			t.Errorf("%s: expected %q, got %v", k, v, n[k])
+		}
+	}
+	if len(n) != len(want) {
+		t.Errorf("expected %d keys, got %d: %v", len(want), len(n), n)
+	}
+}
+
+func TestParseUnescapesText(t *testing.T) {
+	doc := func(text string) string {
+		return `<env:Envelope xmlns:env="urn:envelope"><env:Body><Records><Measure><hjid>1</hjid>` +
+			`<description>` + text + `</description></Measure></Records></env:Body></env:Envelope>`
+	}
+	s := parseString(t, doc(`caf&#233; &lt;&#x26;&gt;`), Options{})
+	if got := elementData(t, s, "1")["description"]; got != "café <&>" {
+		t.Errorf("description = %q, want %q", got, "café <&>")
+	}
+
+	err := Parse(context.Background(), strings.NewReader(doc("fish &chips")), &CountingSink{}, Options{})
+	if err == nil || !strings.Contains(err.Error(), "reading text of description") {
+		t.Errorf("Parse = %v, want an error reading the description's text", err)
+	}
+}
+
+func TestParseKeepsNested(t *testing.T) {
+	if data, err := parseString(t, attributesXML, Options{}).NestedData("1"); err != nil || data != "" {
+		t.Errorf("NestedData without Nested = %q, %v; want nothing stored", data, err)
+	}
+
+	s := parseString(t, attributesXML, Options{Nested: true})
+	data, err := s.NestedData("1")
+	if err != nil {
+		t.Fatalf("NestedData: %v", err)
+	}
+
+	var n map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &n); err != nil {
+		t.Fatalf("decoding nested data: %v", err)
+	}
+	area, ok := n["geographicalArea"].(map[string]interface{})
+	if !ok || area["@areaId"] != "1011" || area["sid"] != "400" {
+		t.Errorf("geographicalArea = %v, want a nested object", n["geographicalArea"])
+	}
+	wrapper, ok := n["wrapper"].(map[string]interface{})
+	if !ok || wrapper["inner"] != "x" {
+		t.Errorf("wrapper = %v, want a nested object", n["wrapper"])
+	}
+	if _, ok := n["geographicalArea.sid"]; ok {
+		t.Errorf("nested data has flattened keys: %v", n)
+	}
+}
+
+func TestParseAttributePrefix(t *testing.T) {
+	s := parseString(t, attributesXML, Options{AttrPrefix: "_attr_"})
+	n := elementData(t, s, "1")
+
+	if n["_attr_xsi:type"] != "MeasureType" {
+		t.Errorf("expected prefixed attribute, got %v", n)
+	}
+	if _, ok := n["@xsi:type"]; ok {
+		t.Errorf("default prefix used despite AttrPrefix option")
+	}
+}
+
+func parseString(t *testing.T, xml string, opts Options) *store.Store {
+	t.Helper()
+
+	s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	if err := Parse(context.Background(), strings.NewReader(xml), s, opts); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return s
+}
+
+func elementData(t *testing.T, s *store.Store, hjid string) map[string]interface{} {
+	t.Helper()
+
+	e, err := s.Element(hjid)
+	if err != nil {
+		t.Fatalf("Element %s: %v", hjid, err)
+	}
+
+	var n map[string]interface{}
+	if err := json.Unmarshal([]byte(e.Data), &n); err != nil {
+		t.Fatalf("decoding element %s: %v", hjid, err)
+	}
+	return n
+}
+
+const operationsXML = `<a><b><c>
+  <Measure><hjid>1</hjid><metainfo><opType>C</opType></metainfo><sid>100</sid></Measure>
+  <Measure><hjid>2</hjid><metainfo><opType>C</opType></metainfo><sid>200</sid></Measure>
+  <Measure><hjid>1</hjid><metainfo><opType>D</opType></metainfo><sid>100</sid></Measure>
+  <Measure><hjid>2</hjid><metainfo><opType>U</opType></metainfo><sid>201</sid></Measure>
+</c></b></a>`
+
+func TestParseApply(t *testing.T) {
+	s := parseString(t, operationsXML, Options{Apply: true})
+
+	if _, err := s.Element("1"); err == nil {
+		t.Error("expected deleted measure to be removed")
+	}
+	n := elementData(t, s, "2")
+	if n["sid"] != "201" || n["metainfo.opType"] != "U" {
+		t.Errorf("expected updated measure, got %v", n)
+	}
+
+	versions, err := s.ElementHistory("1")
+	if err != nil {
+		t.Fatalf("ElementHistory: %v", err)
+	}
+	if len(versions) != 2 || versions[0].OpType != OpCreate || versions[1].OpType != OpDelete {
+		t.Errorf("expected create then delete versions, got %+v", versions)
+	}
+}
+
+func TestParseWithoutApplyKeepsDeletes(t *testing.T) {
+	s := parseString(t, operationsXML, Options{})
+
+	n := elementData(t, s, "1")
+	if n["metainfo.opType"] != "D" {
+		t.Errorf("expected delete record to be stored, got %v", n)
+	}
+}
+
+const childrenXML = `<a><b><c>
+  <Measure><hjid>1</hjid><metainfo><opType>C</opType></metainfo><sid>100</sid>
+    <measureComponent><hjid>11</hjid><metainfo><opType>C</opType></metainfo><dutyAmount>5</dutyAmount></measureComponent>
+    <measureComponent><hjid>12</hjid><metainfo><opType>C</opType></metainfo><dutyAmount>6</dutyAmount></measureComponent>
+    <measureCondition><hjid>13</hjid><metainfo><opType>C</opType></metainfo>
+      <measureConditionComponent><hjid>14</hjid><metainfo><opType>C</opType></metainfo></measureConditionComponent>
+    </measureCondition>
+    <footnoteAssociationMeasure><hjid>15</hjid><metainfo><opType>C</opType></metainfo></footnoteAssociationMeasure>
+    <geographicalArea><sid>400</sid></geographicalArea>
+  </Measure>
+  <Measure><hjid>1</hjid><metainfo><opType>U</opType></metainfo><sid>100</sid>
+    <measureComponent><hjid>11</hjid><metainfo><opType>U</opType></metainfo><dutyAmount>7</dutyAmount></measureComponent>
+    <measureComponent><hjid>12</hjid><metainfo><opType>D</opType></metainfo><dutyAmount>6</dutyAmount></measureComponent>
+    <measureCondition><hjid>13</hjid><metainfo><opType>U</opType></metainfo>
+      <measureConditionComponent><hjid>14</hjid><metainfo><opType>U</opType></metainfo></measureConditionComponent>
+    </measureCondition>
+    <geographicalArea><sid>400</sid></geographicalArea>
+  </Measure>
+</c></b></a>`
+
+func TestParseSplitChildren(t *testing.T) {
+	s := parseString(t, childrenXML, Options{SplitChildren: true, Apply: true})
+
+	n := elementData(t, s, "1")
+	for _, k := range []string{"measureComponent", "measureCondition"} {
+		if _, ok := n[k]; ok {
+			t.Errorf("parent still embeds %s: %v", k, n)
+		}
+	}
+	if n["geographicalArea.sid"] != "400" {
+		t.Errorf("children without metainfo should stay flattened in the parent, got %v", n)
+	}
+
+	children, err := s.Children("1", 10, 0)
+	if err != nil {
+		t.Fatalf("Children: %v", err)
+	}
+	var got []string
+	for _, c := range children {
+		got = append(got, c.Type+":"+c.Hjid)
+	}
+	if want := "measureComponent:11 measureCondition:13"; strings.Join(got, " ") != want {
+		t.Errorf("children = %v, want %s (12 deleted and 15 left out by the update)", got, want)
+	}
+	if _, err := s.Element("15"); err == nil {
+		t.Error("child left out of the update is still stored")
+	}
+	if c := elementData(t, s, "11"); c["dutyAmount"] != "7" || c["metainfo.opType"] != "U" {
+		t.Errorf("component data = %v", c)
+	}
+
+	grandchildren, err := s.Children("13", 10, 0)
+	if err != nil {
+		t.Fatalf("Children: %v", err)
+	}
+	if len(grandchildren) != 1 || grandchildren[0].Hjid != "14" {
+		t.Errorf("condition children = %v, want 14", grandchildren)
+	}
+
+	counts, err := s.TypeCounts()
+	if err != nil {
+		t.Fatalf("TypeCounts: %v", err)
+	}
+	types := map[string]int{}
+	for _, tc := range counts {
+		types[tc.Type] = tc.Count
+	}
+	if types["measureComponent"] != 1 || types["measureConditionComponent"] != 1 {
+		t.Errorf("type counts = %v", types)
+	}
+}
+
+func TestParseSplitChildrenDeletedWithParent(t *testing.T) {
+	s := parseString(t, childrenXML, Options{SplitChildren: true, Apply: true})
+	deleteXML := `<a><b><c>
+  <Measure><hjid>1</hjid><metainfo><opType>D</opType></metainfo></Measure>
+</c></b></a>`
+	if err := Parse(context.Background(), strings.NewReader(deleteXML), s, Options{SplitChildren: true, Apply: true}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	for _, hjid := range []string{"1", "11", "13", "14"} {
+		if _, err := s.Element(hjid); err == nil {
+			t.Errorf("element %s still stored after its measure was deleted", hjid)
+		}
+	}
+}
+
+func TestParseWithoutSplitEmbedsChildren(t *testing.T) {
+	s := parseString(t, childrenXML, Options{})
+	if _, err := s.Element("11"); err == nil {
+		t.Error("child stored as its own row without SplitChildren")
+	}
+	if _, ok := elementData(t, s, "1")["measureComponent"]; !ok {
+		t.Error("expected the component embedded in its measure")
+	}
+}
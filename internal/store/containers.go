@@ -0,0 +1,96 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Container is an element enclosing records, such as the document root or
+// an envelope's body. Its Tree holds the element without its children, so
+// exports can rebuild the document around the stored records.
+type Container struct {
+	ImportID int64 // populated by Containers
+	Seq      int64 // position among the document's containers, from 1
+	Parent   int64 // the enclosing container's Seq, 0 for the root
+	Name     string
+	Tree     string
+}
+
+// TreeRecord is a stored element's XML tree and where it sat in its
+// document.
+type TreeRecord struct {
+	Hjid      string
+	Type      string
+	Tree      string
+	ImportID  int64
+	Seq       int64
+	Container int64
+}
+
+// PutContainer stores a container for the current import, replacing one
+// already stored with the same Seq so resumed imports don't duplicate it.
+// Containers don't count towards the import's totals.
+func (s *Store) PutContainer(c Container) error {
+	if err := s.ensureBatch(false); err != nil {
+		return err
+	}
+	_, err := s.tx.Exec(`INSERT OR REPLACE INTO containers
+		(import_id, seq, parent_seq, name, tree) VALUES (?, ?, ?, ?, ?)`,
+		s.currentImport(), c.Seq, c.Parent, c.Name, c.Tree,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting container: %w", err)
+	}
+	return nil
+}
+
+// Containers returns every stored container, in document order within each
+// import.
+func (s *Store) Containers() ([]Container, error) {
+	rows, err := s.db.Query(`
+		SELECT import_id, seq, parent_seq, name, tree
+		FROM containers ORDER BY import_id, seq`)
+	if err != nil {
+		return nil, fmt.Errorf("querying containers: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var containers []Container
+	for rows.Next() {
+		var c Container
+		var importID sql.NullInt64
+		if err := rows.Scan(&importID, &c.Seq, &c.Parent, &c.Name, &c.Tree); err != nil {
+			return nil, fmt.Errorf("scanning container: %w", err)
+		}
+		c.ImportID = importID.Int64
+		containers = append(containers, c)
+	}
+	return containers, rows.Err()
+}
+
+// EachTree calls fn with every stored element's tree, ordered by import and
+// then by position in the document. Child records split out of an element
+// are part of its tree, so aren't visited. Iteration stops at the first
+// error.
+func (s *Store) EachTree(fn func(t TreeRecord) error) error {
+	rows, err := s.db.Query(`
+		SELECT hjid, type, tree, import_id, seq, container_seq
+		FROM elements WHERE parent_hjid = '' ORDER BY import_id, seq, hjid`)
+	if err != nil {
+		return fmt.Errorf("querying element trees: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	for rows.Next() {
+		var t TreeRecord
+		var importID sql.NullInt64
+		if err := rows.Scan(&t.Hjid, &t.Type, &t.Tree, &importID, &t.Seq, &t.Container); err != nil {
+			return fmt.Errorf("scanning element tree: %w", err)
+		}
+		t.ImportID = importID.Int64
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Version is one entry in an element's history.
+type Version struct {
+	ID              int64 // zero for the current version
+	Hjid            string
+	Type            string
+	Data            string
+	OpType          string
+	TransactionDate string
+	ImportID        int64  // zero if written outside an import
+	ImportName      string // empty if written outside an import
+}
+
+// Change is a single field difference between two versions of an element.
+type Change struct {
+	Field string
+	Old   interface{} // nil if the field was added
+	New   interface{} // nil if the field was removed
+}
+
+// ElementHistory returns every recorded version of an element, oldest first:
+// those replaced or deleted, from element_versions, then the current one.
+func (s *Store) ElementHistory(hjid string) ([]Version, error) {
+	rows, err := s.db.Query(`
+		SELECT v.id, v.hjid, v.type, v.data, v.op_type, v.transaction_date, v.import_id, i.name
+		FROM (
+			SELECT id, hjid, type, data, op_type, transaction_date, import_id, 0 AS current
+			FROM element_versions WHERE hjid = ?1
+			UNION ALL
+			SELECT 0, hjid, type, data, op_type, transaction_date, import_id, 1
+			FROM elements WHERE hjid = ?1
+		) v LEFT JOIN imports i ON i.id = v.import_id
+		ORDER BY v.current, v.id`, hjid)
+	if err != nil {
+		return nil, fmt.Errorf("querying element history: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var versions []Version
+	for rows.Next() {
+		var v Version
+		var importID sql.NullInt64
+		var importName sql.NullString
+		if err := rows.Scan(
+			&v.ID, &v.Hjid, &v.Type, &v.Data, &v.OpType, &v.TransactionDate, &importID, &importName,
+		); err != nil {
+			return nil, fmt.Errorf("scanning version: %w", err)
+		}
+		v.ImportID = importID.Int64
+		v.ImportName = importName.String
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// Diff compares the top-level fields of two JSON objects and returns the
+// changes, sorted by field name. Empty data is treated as an empty object.
+func Diff(oldData, newData string) ([]Change, error) {
+	oldFields, err := decodeFields(oldData)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := decodeFields(newData)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for k, ov := range oldFields {
+		nv, ok := newFields[k]
+		if !ok {
+			changes = append(changes, Change{Field: k, Old: ov})
+		} else if !reflect.DeepEqual(ov, nv) {
+			changes = append(changes, Change{Field: k, Old: ov, New: nv})
+		}
+	}
+	for k, nv := range newFields {
+		if _, ok := oldFields[k]; !ok {
+			changes = append(changes, Change{Field: k, New: nv})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+func decodeFields(data string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if data == "" {
+		return fields, nil
+	}
+	if err := json.Unmarshal([]byte(data), &fields); err != nil {
+		return nil, fmt.Errorf("decoding element data: %w", err)
+	}
+	return fields, nil
+}
@@ -0,0 +1,127 @@
+package store
+
+import "testing"
+
+func TestElementHistory(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { _ = s.Close() }()
+
+	importID, err := s.BeginImport("snapshot.xml", 10)
+	if err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	if err := s.PutRecord(Record{
+		Hjid: "1", Type: "Measure", Data: `{"sid":"100"}`, OpType: "C", TransactionDate: "2024-01-01",
+	}); err != nil {
+		t.Fatalf("PutRecord: %v", err)
+	}
+	if err := s.FinishImport(""); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+
+	if _, err := s.BeginImport("delta.xml", 10); err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	if err := s.PutRecord(Record{
+		Hjid: "1", Type: "Measure", Data: `{"sid":"101"}`, OpType: "U", TransactionDate: "2024-01-02",
+	}); err != nil {
+		t.Fatalf("PutRecord: %v", err)
+	}
+	if err := s.DeleteRecord(Record{Hjid: "1", Type: "Measure", OpType: "D", TransactionDate: "2024-01-03"}); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+	if err := s.FinishImport(""); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+
+	versions, err := s.ElementHistory("1")
+	if err != nil {
+		t.Fatalf("ElementHistory: %v", err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("expected 3 versions, got %d", len(versions))
+	}
+	if versions[0].ImportID != importID || versions[0].ImportName != "snapshot.xml" {
+		t.Errorf("unexpected first version import: %+v", versions[0])
+	}
+	wantOps := []string{"C", "U", "D"}
+	for i, v := range versions {
+		if v.OpType != wantOps[i] {
+			t.Errorf("version %d: expected op %s, got %s", i, wantOps[i], v.OpType)
+		}
+	}
+	if versions[1].TransactionDate != "2024-01-02" || versions[1].ImportName != "delta.xml" {
+		t.Errorf("unexpected second version: %+v", versions[1])
+	}
+}
+
+func TestElementHistoryStoresCurrentVersionOnce(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { _ = s.Close() }()
+
+	for _, r := range []Record{
+		{Hjid: "1", Type: "Measure", Data: `{"sid":"100"}`, OpType: "C", TransactionDate: "2024-01-01"},
+		{Hjid: "1", Type: "Measure", Data: `{"sid":"101"}`, OpType: "U", TransactionDate: "2024-01-02"},
+	} {
+		if err := s.PutRecord(r); err != nil {
+			t.Fatalf("PutRecord: %v", err)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	var archived int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM element_versions").Scan(&archived); err != nil {
+		t.Fatalf("counting versions: %v", err)
+	}
+	if archived != 1 {
+		t.Errorf("element_versions holds %d rows, want only the replaced version", archived)
+	}
+
+	versions, err := s.ElementHistory("1")
+	if err != nil {
+		t.Fatalf("ElementHistory: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Data != `{"sid":"100"}` || versions[0].ID == 0 {
+		t.Fatalf("versions = %+v", versions)
+	}
+	if v := versions[1]; v.ID != 0 || v.Data != `{"sid":"101"}` || v.TransactionDate != "2024-01-02" {
+		t.Errorf("current version = %+v", v)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	changes, err := Diff(`{"a":"1","b":"2","c":"3"}`, `{"a":"1","b":"20","d":"4"}`)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+
+	want := []Change{
+		{Field: "b", Old: "2", New: "20"},
+		{Field: "c", Old: "3"},
+		{Field: "d", New: "4"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d: expected %+v, got %+v", i, want[i], changes[i])
+		}
+	}
+
+	changes, err = Diff("", `{"a":"1"}`)
+	if err != nil {
+		t.Fatalf("Diff from empty: %v", err)
+	}
+	if len(changes) != 1 || changes[0].New != "1" {
+		t.Errorf("unexpected changes from empty: %+v", changes)
+	}
+}
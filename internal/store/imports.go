@@ -0,0 +1,268 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Import statuses. An import is incomplete until it finishes or is aborted,
+// so one left incomplete was interrupted without being able to record why.
+const (
+	ImportIncomplete = "incomplete"
+	ImportComplete   = "complete"
+	ImportCancelled  = "cancelled"
+	ImportFailed     = "failed"
+)
+
+// Import records a file loaded into the database.
+type Import struct {
+	ID         int64
+	Name       string
+	Size       int64 // -1 if unknown
+	Checksum   string
+	StartedAt  time.Time
+	FinishedAt time.Time // zero if the import never finished
+	Inserted   int
+	Deleted    int
+	Rejected   int // records quarantined in parse_errors
+	Status     string
+
+	// Checkpoint is how far the import had got at its last batch commit.
+	Checkpoint Checkpoint
+}
+
+// Checkpoint records the progress of an import as of a batch commit:
+// the number of records committed or quarantined, and the number of source bytes read
+// along with their SHA-256 checksum, so a resumed import can check it is
+// reading the same source.
+type Checkpoint struct {
+	Records  int
+	Bytes    int64
+	Checksum string
+}
+
+// BeginImport records the start of an import. Elements written until
+// FinishImport are counted against it.
+func (s *Store) BeginImport(name string, size int64) (int64, error) {
+	res, err := s.exec(
+		"INSERT INTO imports (name, size, started_at) VALUES (?, ?, ?)",
+		name, size, timestamp(time.Now()),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("recording import: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("reading import id: %w", err)
+	}
+
+	s.importID = id
+	s.inserted = 0
+	s.deleted = 0
+	s.rejected = 0
+	s.records = 0
+	s.batchInserted = 0
+	s.batchDeleted = 0
+	s.batchRejected = 0
+	s.batchRecords = 0
+	s.checkpoint = nil
+	return id, nil
+}
+
+// ResumeImport continues an unfinished import, counting further writes on
+// top of those it already committed.
+func (s *Store) ResumeImport(im *Import) error {
+	if im.Status == ImportComplete {
+		return fmt.Errorf("import %d is already complete", im.ID)
+	}
+	_, err := s.exec(
+		"UPDATE imports SET status = ?, finished_at = NULL WHERE id = ?", ImportIncomplete, im.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("resuming import: %w", err)
+	}
+
+	s.importID = im.ID
+	s.inserted = im.Inserted
+	s.deleted = im.Deleted
+	s.rejected = im.Rejected
+	s.records = im.Checkpoint.Records
+	s.batchInserted = 0
+	s.batchDeleted = 0
+	s.batchRejected = 0
+	s.batchRecords = 0
+	s.checkpoint = nil
+	return nil
+}
+
+// SetCheckpointSource makes each batch commit in the current import save a
+// checkpoint, taking the bytes read and their checksum from fn. fn may be
+// called from whichever goroutine writes to the store.
+func (s *Store) SetCheckpointSource(fn func() (bytes int64, checksum string)) {
+	s.checkpoint = fn
+}
+
+// saveCheckpoint records the current import's progress inside the open
+// batch, so the checkpoint commits atomically with the records it counts.
+func (s *Store) saveCheckpoint() error {
+	if s.importID == 0 || s.checkpoint == nil {
+		return nil
+	}
+	n, checksum := s.checkpoint()
+	_, err := s.tx.Exec(
+		`UPDATE imports SET inserted = ?, deleted = ?, rejected = ?,
+			checkpoint_records = ?, checkpoint_bytes = ?, checkpoint_checksum = ? WHERE id = ?`,
+		s.inserted, s.deleted, s.rejected, s.records, n, checksum, s.importID,
+	)
+	if err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+	return nil
+}
+
+// FinishImport flushes pending writes and records the checksum and row counts
+// of the current import.
+func (s *Store) FinishImport(checksum string) error {
+	if s.importID == 0 {
+		return fmt.Errorf("no import in progress")
+	}
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	if err := s.syncPending(); err != nil {
+		return err
+	}
+
+	_, err := s.exec(
+		"UPDATE imports SET checksum = ?, finished_at = ?, inserted = ?, deleted = ?, rejected = ?, status = ? WHERE id = ?",
+		checksum, timestamp(time.Now()), s.inserted, s.deleted, s.rejected, ImportComplete, s.importID,
+	)
+	if err != nil {
+		return fmt.Errorf("finishing import: %w", err)
+	}
+
+	s.importID = 0
+	s.checkpoint = nil
+	return nil
+}
+
+// AbortImport rolls back the current batch and marks the import with status
+// (ImportCancelled or ImportFailed). Batches already committed are kept and
+// counted, so the database reflects exactly the rows the import wrote.
+func (s *Store) AbortImport(status string) error {
+	if s.importID == 0 {
+		return fmt.Errorf("no import in progress")
+	}
+	if err := s.Rollback(); err != nil {
+		return err
+	}
+	if err := s.syncPending(); err != nil {
+		return err
+	}
+
+	_, err := s.exec(
+		"UPDATE imports SET finished_at = ?, inserted = ?, deleted = ?, rejected = ?, status = ? WHERE id = ?",
+		timestamp(time.Now()), s.inserted, s.deleted, s.rejected, status, s.importID,
+	)
+	if err != nil {
+		return fmt.Errorf("aborting import: %w", err)
+	}
+
+	s.importID = 0
+	s.checkpoint = nil
+	return nil
+}
+
+const importColumns = `id, name, size, checksum, started_at, finished_at, inserted, deleted, rejected, status,
+	checkpoint_records, checkpoint_bytes, checkpoint_checksum`
+
+func (s *Store) Imports() ([]Import, error) {
+	rows, err := s.db.Query("SELECT " + importColumns + " FROM imports ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("querying imports: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var imports []Import
+	for rows.Next() {
+		im, err := scanImport(rows)
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, *im)
+	}
+	return imports, rows.Err()
+}
+
+// LastImport returns the most recent import of the named source, or nil if
+// it has never been imported.
+func (s *Store) LastImport(name string) (*Import, error) {
+	row := s.db.QueryRow("SELECT "+importColumns+" FROM imports WHERE name = ? ORDER BY id DESC LIMIT 1", name)
+	im, err := scanImport(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return im, err
+}
+
+func scanImport(row interface{ Scan(...interface{}) error }) (*Import, error) {
+	var im Import
+	var started string
+	var finished sql.NullString
+	err := row.Scan(
+		&im.ID, &im.Name, &im.Size, &im.Checksum, &started, &finished, &im.Inserted, &im.Deleted, &im.Rejected, &im.Status,
+		&im.Checkpoint.Records, &im.Checkpoint.Bytes, &im.Checkpoint.Checksum,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scanning import: %w", err)
+	}
+	im.StartedAt, _ = time.Parse(time.RFC3339Nano, started)
+	if finished.Valid {
+		im.FinishedAt, _ = time.Parse(time.RFC3339Nano, finished.String)
+	}
+	return &im, nil
+}
+
+// exec runs a statement inside the current batch if one is open, so it
+// doesn't contend with the batch for the write lock.
+func (s *Store) exec(query string, args ...interface{}) (sql.Result, error) {
+	if s.tx != nil {
+		return s.tx.Exec(query, args...)
+	}
+	return s.db.Exec(query, args...)
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// ParseErrors returns the records quarantined by an import, in the order
+// they were read.
+func (s *Store) ParseErrors(importID int64) ([]BadRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT kind, hjid, type, path, line, col, offset, error, fragment
+		FROM parse_errors WHERE import_id = ? ORDER BY id`, importID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying parse errors: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var bad []BadRecord
+	for rows.Next() {
+		var b BadRecord
+		if err := rows.Scan(
+			&b.Kind, &b.Hjid, &b.Type, &b.Path, &b.Line, &b.Column, &b.Offset, &b.Error, &b.Fragment,
+		); err != nil {
+			return nil, fmt.Errorf("scanning parse error: %w", err)
+		}
+		bad = append(bad, b)
+	}
+	return bad, rows.Err()
+}
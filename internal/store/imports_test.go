@@ -0,0 +1,271 @@
+package store
+
+import "testing"
+
+func TestOpenAppendKeepsElements(t *testing.T) {
+	path := tempDB(t)
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.InsertElement("1", "A", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = OpenWith(path, OpenOptions{Append: true})
+	if err != nil {
+		t.Fatalf("OpenWith append: %v", err)
+	}
+	if err := s.InsertElement("2", "A", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if n, _ := s.ElementCount("A"); n != 2 {
+		t.Errorf("expected appended store to hold 2 elements, got %d", n)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { _ = s.Close() }()
+	if n, _ := s.ElementCount("A"); n != 0 {
+		t.Errorf("expected Open to clear elements, got %d", n)
+	}
+}
+
+func TestImports(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { _ = s.Close() }()
+
+	id, err := s.BeginImport("export-20240101.xml", 1234)
+	if err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	for _, hjid := range []string{"1", "2", "3"} {
+		if err := s.InsertElement(hjid, "A", `{}`); err != nil {
+			t.Fatalf("InsertElement: %v", err)
+		}
+	}
+	// Deleting an element that isn't stored isn't counted.
+	for _, hjid := range []string{"2", "99"} {
+		if err := s.DeleteElement(hjid); err != nil {
+			t.Fatalf("DeleteElement: %v", err)
+		}
+	}
+	if err := s.FinishImport("abc123"); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+
+	imports, err := s.Imports()
+	if err != nil {
+		t.Fatalf("Imports: %v", err)
+	}
+	if len(imports) != 1 {
+		t.Fatalf("expected 1 import, got %d", len(imports))
+	}
+
+	im := imports[0]
+	if im.ID != id || im.Name != "export-20240101.xml" || im.Size != 1234 || im.Checksum != "abc123" {
+		t.Errorf("unexpected import: %+v", im)
+	}
+	if im.Inserted != 3 || im.Deleted != 1 {
+		t.Errorf("expected 3 inserted and 1 deleted, got %d and %d", im.Inserted, im.Deleted)
+	}
+	if im.Status != ImportComplete {
+		t.Errorf("expected status %q, got %q", ImportComplete, im.Status)
+	}
+	e, err := s.Element("1")
+	if err != nil {
+		t.Fatalf("Element: %v", err)
+	}
+	if e.Source != "export-20240101.xml" {
+		t.Errorf("expected element source to be recorded, got %q", e.Source)
+	}
+	if im.StartedAt.IsZero() || im.FinishedAt.IsZero() || im.FinishedAt.Before(im.StartedAt) {
+		t.Errorf("unexpected timestamps: %v - %v", im.StartedAt, im.FinishedAt)
+	}
+}
+
+func TestAbortImport(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { _ = s.Close() }()
+
+	if _, err := s.BeginImport("delta.xml", -1); err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	if err := s.InsertElement("1", "A", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := s.InsertElement("2", "A", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.AbortImport(ImportCancelled); err != nil {
+		t.Fatalf("AbortImport: %v", err)
+	}
+
+	if n, _ := s.ElementCount("A"); n != 1 {
+		t.Errorf("expected only the committed element to remain, got %d", n)
+	}
+	versions, err := s.ElementHistory("2")
+	if err != nil {
+		t.Fatalf("ElementHistory: %v", err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("expected rolled back version to be discarded, got %d", len(versions))
+	}
+
+	imports, err := s.Imports()
+	if err != nil {
+		t.Fatalf("Imports: %v", err)
+	}
+	im := imports[0]
+	if im.Status != ImportCancelled || im.Inserted != 1 || im.FinishedAt.IsZero() {
+		t.Errorf("unexpected aborted import: %+v", im)
+	}
+
+	// The store is usable for further imports.
+	if _, err := s.BeginImport("next.xml", -1); err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	if err := s.InsertElement("3", "A", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.FinishImport(""); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+}
+
+func TestCheckpointAndResume(t *testing.T) {
+	path := tempDB(t)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if _, err := s.BeginImport("big.xml", 100); err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	s.SetCheckpointSource(func() (int64, string) { return 40, "prefix" })
+	for _, hjid := range []string{"1", "2"} {
+		if err := s.InsertElement(hjid, "A", `{}`); err != nil {
+			t.Fatalf("InsertElement: %v", err)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	// Simulate a crash: the next batch is never committed.
+	if err := s.InsertElement("3", "A", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = OpenWith(path, OpenOptions{Append: true})
+	if err != nil {
+		t.Fatalf("OpenWith: %v", err)
+	}
+	defer func() { _ = s.Close() }()
+
+	im, err := s.LastImport("big.xml")
+	if err != nil {
+		t.Fatalf("LastImport: %v", err)
+	}
+	want := Checkpoint{Records: 2, Bytes: 40, Checksum: "prefix"}
+	if im == nil || im.Status != ImportIncomplete || im.Checkpoint != want || im.Inserted != 2 {
+		t.Fatalf("unexpected interrupted import: %+v", im)
+	}
+
+	if err := s.ResumeImport(im); err != nil {
+		t.Fatalf("ResumeImport: %v", err)
+	}
+	if err := s.InsertElement("3", "A", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.FinishImport("full"); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+
+	im, err = s.LastImport("big.xml")
+	if err != nil {
+		t.Fatalf("LastImport: %v", err)
+	}
+	if im.Status != ImportComplete || im.Inserted != 3 {
+		t.Errorf("unexpected resumed import: %+v", im)
+	}
+	if err := s.ResumeImport(im); err == nil {
+		t.Error("expected resuming a complete import to fail")
+	}
+
+	if im, err := s.LastImport("other.xml"); err != nil || im != nil {
+		t.Errorf("LastImport of unknown source = %+v, %v", im, err)
+	}
+}
+
+func TestQuarantineRecord(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { _ = s.Close() }()
+
+	id, err := s.BeginImport("bad.xml", -1)
+	if err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	bad := BadRecord{
+		Kind: "malformed", Hjid: "2", Type: "Measure", Path: "/a/Measure",
+		Line: 3, Column: 5, Offset: 40, Error: "invalid attribute", Fragment: "<Measure><x a=1/></Measure>",
+	}
+	if err := s.QuarantineRecord(bad); err != nil {
+		t.Fatalf("QuarantineRecord: %v", err)
+	}
+	if err := s.InsertElement("1", "Measure", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.FinishImport(""); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+
+	got, err := s.ParseErrors(id)
+	if err != nil {
+		t.Fatalf("ParseErrors: %v", err)
+	}
+	if len(got) != 1 || got[0] != bad {
+		t.Errorf("got %+v, want %+v", got, bad)
+	}
+	if n, _ := s.ElementCount("Measure"); n != 1 {
+		t.Errorf("expected a quarantined record not to be stored, got %d elements", n)
+	}
+
+	im, err := s.LastImport("bad.xml")
+	if err != nil {
+		t.Fatalf("LastImport: %v", err)
+	}
+	if im.Inserted != 1 || im.Rejected != 1 {
+		t.Errorf("expected 1 inserted and 1 rejected, got %d and %d", im.Inserted, im.Rejected)
+	}
+}
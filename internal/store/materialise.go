@@ -0,0 +1,430 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxFields is the most fields a materialised table can hold, leaving a
+// column for hjid within SQLite's limit of 2000.
+const maxFields = 1999
+
+// MaterialisedTable is a relational copy of one element type's data, with
+// a column per field. Its rows are brought up to date as each import ends;
+// fields first seen after it was built are left out until it is rebuilt.
+type MaterialisedTable struct {
+	Type    string
+	Table   string
+	Columns int
+	Indexes int
+	Rows    int64
+	BuiltAt time.Time
+}
+
+type field struct {
+	name     string
+	affinity string // INTEGER, REAL or TEXT
+}
+
+var unsafeTableChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// materialisedName is the table holding an element type, such as t_Measure.
+func materialisedName(elementType string) string {
+	return "t_" + unsafeTableChars.ReplaceAllString(elementType, "_")
+}
+
+// Materialise builds a table for each of the given element types, or for
+// every stored type if none are given, replacing any built before. Each
+// table has an hjid primary key and a column per field found in the type's
+// data, typed INTEGER or REAL when every value is a plain number and TEXT
+// otherwise. Key fields (sid, fields ending in Sid or .sid, and validity
+// dates) are indexed.
+func (s *Store) Materialise(types []string) ([]MaterialisedTable, error) {
+	if len(types) == 0 {
+		counts, err := s.TypeCounts()
+		if err != nil {
+			return nil, err
+		}
+		for _, tc := range counts {
+			types = append(types, tc.Type)
+		}
+	}
+
+	var tables []MaterialisedTable
+	for _, elementType := range types {
+		t, err := s.materialise(elementType)
+		if err != nil {
+			return tables, fmt.Errorf("materialising %s: %w", elementType, err)
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+func (s *Store) materialise(elementType string) (MaterialisedTable, error) {
+	t := MaterialisedTable{Type: elementType, Table: materialisedName(elementType), BuiltAt: time.Now()}
+
+	var owner string
+	err := s.db.QueryRow("SELECT type FROM materialised WHERE table_name = ?", t.Table).Scan(&owner)
+	if err == nil && owner != elementType {
+		return t, fmt.Errorf("table %s already holds type %s", t.Table, owner)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return t, fmt.Errorf("reading materialised tables: %w", err)
+	}
+
+	fields, err := s.inferFields(elementType)
+	if err != nil {
+		return t, err
+	}
+	if len(fields) > maxFields {
+		return t, fmt.Errorf("%d fields is more than a table can hold (%d); try --split-children",
+			len(fields), maxFields)
+	}
+	if err := checkNames(t.Table, fields); err != nil {
+		return t, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return t, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := dropMaterialised(tx, t.Table); err != nil {
+		return t, err
+	}
+
+	table := quoteIdent(t.Table)
+	columns := []string{"hjid"}
+	defs := []string{"hjid TEXT PRIMARY KEY"}
+	for _, f := range fields {
+		columns = append(columns, f.name)
+		defs = append(defs, quoteIdent(f.name)+" "+f.affinity)
+	}
+	if _, err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(defs, ", "))); err != nil {
+		return t, fmt.Errorf("building %s: %w", t.Table, err)
+	}
+	if t.Rows, err = copyElements(tx, t.Table, elementType, columns, "elements e"); err != nil {
+		return t, err
+	}
+	for _, f := range fields {
+		if !keyField(f.name) {
+			continue
+		}
+		_, err := tx.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)",
+			quoteIdent(indexName(t.Table, f.name)), table, quoteIdent(f.name)))
+		if err != nil {
+			return t, fmt.Errorf("building %s: %w", t.Table, err)
+		}
+		t.Indexes++
+	}
+
+	t.Columns = len(columns)
+	_, err = tx.Exec(`INSERT OR REPLACE INTO materialised (type, table_name, columns, built_at)
+		VALUES (?, ?, ?, ?)`, elementType, t.Table, t.Columns, timestamp(t.BuiltAt))
+	if err != nil {
+		return t, fmt.Errorf("recording %s: %w", t.Table, err)
+	}
+	if err := trackMaterialised(tx); err != nil {
+		return t, err
+	}
+	if err := tx.Commit(); err != nil {
+		return t, fmt.Errorf("committing %s: %w", t.Table, err)
+	}
+	return t, nil
+}
+
+// materialisedTriggers note the elements of materialised types that are
+// deleted or change hjid or type, for syncMaterialised to remove from
+// their tables. Rows written are found through elements_pending.
+const materialisedTriggers = `
+CREATE TRIGGER IF NOT EXISTS materialised_remove AFTER DELETE ON elements
+WHEN old.type IN (SELECT type FROM materialised) BEGIN
+    INSERT INTO materialised_removed (hjid, type) VALUES (old.hjid, old.type);
+END;
+CREATE TRIGGER IF NOT EXISTS materialised_update AFTER UPDATE OF hjid, type ON elements
+WHEN old.type IN (SELECT type FROM materialised) BEGIN
+    INSERT INTO materialised_removed (hjid, type) VALUES (old.hjid, old.type);
+END;`
+
+// trackMaterialised creates materialisedTriggers while there are
+// materialised tables, and drops them once there are none, so writes to a
+// store without any don't run them.
+func trackMaterialised(tx *sql.Tx) error {
+	var any bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM materialised)").Scan(&any); err != nil {
+		return fmt.Errorf("listing materialised tables: %w", err)
+	}
+	stmt := materialisedTriggers
+	if !any {
+		stmt = `
+DROP TRIGGER IF EXISTS materialised_remove;
+DROP TRIGGER IF EXISTS materialised_update;
+DELETE FROM materialised_removed;`
+	}
+	if _, err := tx.Exec(stmt); err != nil {
+		return fmt.Errorf("updating materialised triggers: %w", err)
+	}
+	return nil
+}
+
+// copyElements copies the elements of elementType in from, a FROM clause
+// naming elements e, into the columns of a materialised table, replacing
+// rows already there. It returns the number of rows copied.
+func copyElements(tx *sql.Tx, table, elementType string, columns []string, from string) (int64, error) {
+	names := make([]string, len(columns))
+	values := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = quoteIdent(c)
+		if c == "hjid" {
+			values[i] = "e.hjid"
+		} else {
+			values[i] = "json_extract(e.data, " + quoteLiteral(`$."`+c+`"`) + ")"
+		}
+	}
+	res, err := tx.Exec(fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) SELECT %s FROM %s WHERE e.type = ?",
+		quoteIdent(table), strings.Join(names, ", "), strings.Join(values, ", "), from), elementType)
+	if err != nil {
+		return 0, fmt.Errorf("filling %s: %w", table, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("filling %s: %w", table, err)
+	}
+	return n, nil
+}
+
+// syncMaterialised brings every materialised table up to date with the
+// elements removed and written since it last ran, as noted in
+// materialised_removed and elements_pending.
+func syncMaterialised(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT type, table_name FROM materialised ORDER BY type")
+	if err != nil {
+		return fmt.Errorf("querying materialised tables: %w", err)
+	}
+	var types, tables []string
+	for rows.Next() {
+		var typ, table string
+		if err := rows.Scan(&typ, &table); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("scanning materialised table: %w", err)
+		}
+		types, tables = append(types, typ), append(tables, table)
+	}
+	err = rows.Err()
+	_ = rows.Close()
+	if err != nil {
+		return fmt.Errorf("querying materialised tables: %w", err)
+	}
+
+	for i, table := range tables {
+		columns, err := tableColumns(tx, table)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM "+quoteIdent(table)+
+			" WHERE hjid IN (SELECT hjid FROM materialised_removed WHERE type = ?)", types[i])
+		if err != nil {
+			return fmt.Errorf("updating %s: %w", table, err)
+		}
+		if _, err := copyElements(tx, table, types[i], columns,
+			"elements_pending p JOIN elements e ON e.rowid = p.id"); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM materialised_removed"); err != nil {
+		return fmt.Errorf("clearing removed elements: %w", err)
+	}
+	return nil
+}
+
+// tableColumns lists a table's columns in order.
+func tableColumns(tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?) ORDER BY cid", table)
+	if err != nil {
+		return nil, fmt.Errorf("reading columns of %s: %w", table, err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var columns []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, fmt.Errorf("reading columns of %s: %w", table, err)
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// inferFields lists the fields in a type's data, by name, with the column
+// affinity their values fit. A value is a number only if it reads back
+// unchanged, so codes with leading zeros stay text.
+func (s *Store) inferFields(elementType string) ([]field, error) {
+	rows, err := s.db.Query(`
+		SELECT f.key, COUNT(*), SUM(`+integerValue+`), SUM(`+integerValue+` OR `+realValue+`)
+		FROM elements e, json_each(e.data) f
+		WHERE e.type = ? AND f.type != 'null'
+		GROUP BY f.key ORDER BY f.key`, elementType)
+	if err != nil {
+		return nil, fmt.Errorf("inferring fields: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var fields []field
+	for rows.Next() {
+		var name string
+		var values, integers, reals int
+		if err := rows.Scan(&name, &values, &integers, &reals); err != nil {
+			return nil, fmt.Errorf("scanning field: %w", err)
+		}
+		// hjid is the element's key column; fields that can't be named in
+		// a JSON path are left out.
+		if _, err := fieldPath(name); err != nil || strings.EqualFold(name, "hjid") {
+			continue
+		}
+		f := field{name: name, affinity: "TEXT"}
+		switch values {
+		case integers:
+			f.affinity = "INTEGER"
+		case reals:
+			f.affinity = "REAL"
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+// indexName is the name of the index on a materialised table's field.
+func indexName(table, field string) string {
+	return table + "_" + unsafeTableChars.ReplaceAllString(field, "_")
+}
+
+// checkNames reports fields whose columns or indexes would share a name.
+// SQLite doesn't tell names apart by case, and index names replace the
+// characters tables can't use, so a.b.sid and a_b.sid share one.
+func checkNames(table string, fields []field) error {
+	columns := map[string]string{}
+	indexes := map[string]string{}
+	for _, f := range fields {
+		if other, ok := columns[strings.ToLower(f.name)]; ok {
+			return fmt.Errorf("fields %q and %q differ only in case, so can't both be columns", other, f.name)
+		}
+		columns[strings.ToLower(f.name)] = f.name
+		if !keyField(f.name) {
+			continue
+		}
+		index := indexName(table, f.name)
+		if other, ok := indexes[strings.ToLower(index)]; ok {
+			return fmt.Errorf("fields %q and %q would both be indexed as %s", other, f.name, index)
+		}
+		indexes[strings.ToLower(index)] = f.name
+	}
+	return nil
+}
+
+// keyField reports whether a field is worth indexing: sids and validity
+// dates, outside repeated children.
+func keyField(name string) bool {
+	if strings.Contains(name, "[") {
+		return false
+	}
+	last := name[strings.LastIndex(name, ".")+1:]
+	return last == "sid" || strings.HasSuffix(last, "Sid") ||
+		last == "validityStartDate" || last == "validityEndDate"
+}
+
+// DropMaterialised removes the tables built for the given element types,
+// or every materialised table if none are given.
+func (s *Store) DropMaterialised(types []string) error {
+	tables, err := s.MaterialisedTables()
+	if err != nil {
+		return err
+	}
+	drop := map[string]bool{}
+	for _, typ := range types {
+		drop[typ] = true
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for _, t := range tables {
+		if len(types) > 0 && !drop[t.Type] {
+			continue
+		}
+		if err := dropMaterialised(tx, t.Table); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM materialised WHERE type = ?", t.Type); err != nil {
+			return fmt.Errorf("dropping %s: %w", t.Table, err)
+		}
+	}
+	if err := trackMaterialised(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing: %w", err)
+	}
+	return nil
+}
+
+func dropMaterialised(tx *sql.Tx, table string) error {
+	if _, err := tx.Exec("DROP TABLE IF EXISTS " + quoteIdent(table)); err != nil {
+		return fmt.Errorf("dropping %s: %w", table, err)
+	}
+	return nil
+}
+
+// MaterialisedTables lists the tables built by Materialise, with their
+// current row counts.
+func (s *Store) MaterialisedTables() ([]MaterialisedTable, error) {
+	rows, err := s.db.Query(`
+		SELECT m.type, m.table_name, m.columns, m.built_at,
+		       (SELECT COUNT(*) FROM sqlite_master
+		        WHERE type = 'index' AND tbl_name = m.table_name AND name NOT LIKE 'sqlite_%')
+		FROM materialised m ORDER BY m.type`)
+	if err != nil {
+		return nil, fmt.Errorf("querying materialised tables: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var tables []MaterialisedTable
+	for rows.Next() {
+		var t MaterialisedTable
+		var builtAt string
+		if err := rows.Scan(&t.Type, &t.Table, &t.Columns, &builtAt, &t.Indexes); err != nil {
+			return nil, fmt.Errorf("scanning materialised table: %w", err)
+		}
+		if t.BuiltAt, err = time.Parse(time.RFC3339Nano, builtAt); err != nil {
+			return nil, fmt.Errorf("parsing build time of %s: %w", t.Table, err)
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range tables {
+		err := s.db.QueryRow("SELECT COUNT(*) FROM " + quoteIdent(tables[i].Table)).Scan(&tables[i].Rows)
+		if err != nil {
+			return nil, fmt.Errorf("counting %s: %w", tables[i].Table, err)
+		}
+	}
+	return tables, nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
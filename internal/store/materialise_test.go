@@ -0,0 +1,199 @@
+package store
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMaterialise(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	put := func(r Record) {
+		t.Helper()
+		if err := s.PutRecord(r); err != nil {
+			t.Fatalf("PutRecord: %v", err)
+		}
+		if err := s.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+	}
+	put(Record{Hjid: "1", Type: "Measure", Data: `{"hjid":"1","sid":"10","goodsNomenclature.sid":"5","goodsNomenclature.code":"0101000000","dutyAmount":"9.5","validityStartDate":"2024-01-01"}`})
+	put(Record{Hjid: "2", Type: "Measure", Data: `{"hjid":"2","sid":"11","goodsNomenclature.sid":"6","goodsNomenclature.code":"0202000000","dutyAmount":"12"}`})
+	put(Record{Hjid: "3", Type: "Footnote", Data: `{"hjid":"3","description":"it's here"}`})
+
+	tables, err := s.Materialise([]string{"Measure"})
+	if err != nil {
+		t.Fatalf("Materialise: %v", err)
+	}
+	if len(tables) != 1 || tables[0].Table != "t_Measure" || tables[0].Rows != 2 || tables[0].Columns != 6 || tables[0].Indexes != 3 {
+		t.Fatalf("Materialise = %+v", tables)
+	}
+
+	var c collect
+	if err := s.SQL(&c, "SELECT name, type FROM pragma_table_info('t_Measure') ORDER BY cid"); err != nil {
+		t.Fatalf("table_info: %v", err)
+	}
+	want := [][]interface{}{
+		{"hjid", "TEXT"},
+		{"dutyAmount", "REAL"},
+		{"goodsNomenclature.code", "TEXT"},
+		{"goodsNomenclature.sid", "INTEGER"},
+		{"sid", "INTEGER"},
+		{"validityStartDate", "TEXT"},
+	}
+	if !reflect.DeepEqual(c.rows, want) {
+		t.Errorf("columns = %v, want %v", c.rows, want)
+	}
+
+	rows := func() [][]interface{} {
+		t.Helper()
+		var c collect
+		if err := s.SQL(&c, `SELECT hjid, sid, "goodsNomenclature.code", dutyAmount, validityStartDate FROM t_Measure ORDER BY hjid`); err != nil {
+			t.Fatalf("querying t_Measure: %v", err)
+		}
+		return c.rows
+	}
+	want = [][]interface{}{
+		{"1", int64(10), "0101000000", 9.5, "2024-01-01"},
+		{"2", int64(11), "0202000000", float64(12), nil},
+	}
+	if got := rows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+
+	// Later writes to elements reach the table.
+	put(Record{Hjid: "4", Type: "Measure", Data: `{"sid":"12","newField":"x"}`})
+	put(Record{Hjid: "1", Type: "Measure", Data: `{"sid":"20"}`})
+	if err := s.DeleteRecord(Record{Hjid: "2", Type: "Measure"}); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+	put(Record{Hjid: "4", Type: "Footnote", Data: `{"description":"retyped"}`})
+	want = [][]interface{}{{"1", int64(20), nil, nil, nil}}
+	if got := rows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows after writes = %v, want %v", got, want)
+	}
+
+	// Building every type includes quoted values and replaces t_Measure.
+	if tables, err = s.Materialise(nil); err != nil || len(tables) != 2 {
+		t.Fatalf("Materialise all = %+v, %v", tables, err)
+	}
+	listed, err := s.MaterialisedTables()
+	if err != nil || len(listed) != 2 || listed[0].Table != "t_Footnote" || listed[0].Rows != 2 || listed[1].Columns != 2 {
+		t.Errorf("MaterialisedTables = %+v, %v", listed, err)
+	}
+
+	if err := s.DropMaterialised([]string{"Footnote"}); err != nil {
+		t.Fatalf("DropMaterialised: %v", err)
+	}
+	if listed, err = s.MaterialisedTables(); err != nil || len(listed) != 1 || listed[0].Type != "Measure" {
+		t.Errorf("after drop = %+v, %v", listed, err)
+	}
+	put(Record{Hjid: "5", Type: "Footnote", Data: `{"description":"no table"}`})
+
+	// Writes only note removals while some table is materialised.
+	if ok, err := hasObject("trigger", "materialised_remove")(s.db); err != nil || !ok {
+		t.Errorf("materialised_remove with t_Measure = %v, %v", ok, err)
+	}
+	if err := s.DropMaterialised(nil); err != nil {
+		t.Fatalf("DropMaterialised all: %v", err)
+	}
+	if ok, err := hasObject("trigger", "materialised_remove")(s.db); err != nil || ok {
+		t.Errorf("materialised_remove without tables = %v, %v", ok, err)
+	}
+}
+
+func TestMaterialiseRefusesCollidingNames(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	for _, r := range []Record{
+		{Hjid: "1", Type: "Measure", Data: `{"a.b.sid":"1","a_b.sid":"2"}`},
+		{Hjid: "2", Type: "Footnote", Data: `{"code":"1","Code":"2"}`},
+	} {
+		if err := s.PutRecord(r); err != nil {
+			t.Fatalf("PutRecord: %v", err)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	for typ, want := range map[string]string{
+		"Measure":  `fields "a.b.sid" and "a_b.sid" would both be indexed as t_Measure_a_b_sid`,
+		"Footnote": `fields "Code" and "code" differ only in case`,
+	} {
+		if _, err := s.Materialise([]string{typ}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Materialise(%s) = %v, want an error containing %s", typ, err, want)
+		}
+	}
+	if tables, err := s.MaterialisedTables(); err != nil || len(tables) != 0 {
+		t.Errorf("MaterialisedTables = %+v, %v; want none", tables, err)
+	}
+}
+
+func TestMaterialisedTablesCatchUpWhenImportEnds(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	for _, hjid := range []string{"1", "2"} {
+		if err := s.PutRecord(Record{Hjid: hjid, Type: "Measure", Data: `{"sid":"` + hjid + `"}`}); err != nil {
+			t.Fatalf("PutRecord: %v", err)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if _, err := s.Materialise(nil); err != nil {
+		t.Fatalf("Materialise: %v", err)
+	}
+
+	if _, err := s.BeginImport("delta.xml", -1); err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	for _, r := range []Record{
+		{Hjid: "2", Type: "Measure", Data: `{"sid":"20"}`},
+		{Hjid: "3", Type: "Measure", Data: `{"sid":"3"}`},
+	} {
+		if err := s.PutRecord(r); err != nil {
+			t.Fatalf("PutRecord: %v", err)
+		}
+	}
+	if err := s.DeleteRecord(Record{Hjid: "1", Type: "Measure"}); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	rows := func() [][]interface{} {
+		t.Helper()
+		var c collect
+		if err := s.SQL(&c, "SELECT hjid, sid FROM t_Measure ORDER BY hjid"); err != nil {
+			t.Fatalf("querying t_Measure: %v", err)
+		}
+		return c.rows
+	}
+	want := [][]interface{}{{"1", int64(1)}, {"2", int64(2)}}
+	if got := rows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows during the import = %v, want %v", got, want)
+	}
+
+	if err := s.FinishImport(""); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+	want = [][]interface{}{{"2", int64(20)}, {"3", int64(3)}}
+	if got := rows(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows after the import = %v, want %v", got, want)
+	}
+}
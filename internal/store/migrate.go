@@ -0,0 +1,504 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is one forward-only change to the schema. Migrations are never
+// edited once released: a change to the schema is a new migration at the
+// end of the list.
+type migration struct {
+	name string
+	sql  string
+	// run, if set, makes changes sql can't express, after sql has run.
+	run func(tx *sql.Tx) error
+	// legacy reports whether a database created before schema_version
+	// existed already has this migration's changes.
+	legacy func(db *sql.DB) (bool, error)
+}
+
+// migrations holds the schema's history; the database is at version n once
+// the first n have been applied.
+var migrations = []migration{
+	{
+		name: "elements",
+		sql: `
+CREATE TABLE elements (
+    hjid       TEXT    PRIMARY KEY,
+    type       TEXT    NOT NULL,
+    data       TEXT    NOT NULL
+);
+CREATE INDEX idx_elements_type ON elements(type);
+CREATE VIEW type_counts AS
+    SELECT type, COUNT(*) AS count FROM elements GROUP BY type ORDER BY count DESC;`,
+		legacy: hasTable("elements"),
+	},
+	{
+		name: "imports",
+		sql: `
+CREATE TABLE imports (
+    id          INTEGER PRIMARY KEY,
+    name        TEXT    NOT NULL,
+    size        INTEGER NOT NULL,
+    checksum    TEXT    NOT NULL DEFAULT '',
+    started_at  TEXT    NOT NULL,
+    finished_at TEXT,
+    inserted    INTEGER NOT NULL DEFAULT 0,
+    deleted     INTEGER NOT NULL DEFAULT 0
+);`,
+		legacy: hasTable("imports"),
+	},
+	{
+		name: "element versions",
+		sql: `
+CREATE TABLE element_versions (
+    id               INTEGER PRIMARY KEY,
+    hjid             TEXT    NOT NULL,
+    type             TEXT    NOT NULL,
+    data             TEXT    NOT NULL,
+    op_type          TEXT    NOT NULL DEFAULT '',
+    transaction_date TEXT    NOT NULL DEFAULT '',
+    import_id        INTEGER REFERENCES imports(id)
+);
+CREATE INDEX idx_element_versions_hjid ON element_versions(hjid);`,
+		legacy: hasTable("element_versions"),
+	},
+	{
+		name:   "element import",
+		sql:    `ALTER TABLE elements ADD COLUMN import_id INTEGER REFERENCES imports(id);`,
+		legacy: hasColumn("elements", "import_id"),
+	},
+	{
+		name: "import status",
+		sql: `
+ALTER TABLE imports ADD COLUMN status TEXT NOT NULL DEFAULT 'incomplete';
+UPDATE imports SET status = 'complete' WHERE finished_at IS NOT NULL;`,
+		legacy: hasColumn("imports", "status"),
+	},
+	{
+		name: "import checkpoints",
+		sql: `
+ALTER TABLE imports ADD COLUMN checkpoint_records INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE imports ADD COLUMN checkpoint_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE imports ADD COLUMN checkpoint_checksum TEXT NOT NULL DEFAULT '';`,
+		legacy: hasColumn("imports", "checkpoint_records"),
+	},
+	{
+		name: "parse errors",
+		sql: `
+ALTER TABLE imports ADD COLUMN rejected INTEGER NOT NULL DEFAULT 0;
+CREATE TABLE parse_errors (
+    id        INTEGER PRIMARY KEY,
+    import_id INTEGER REFERENCES imports(id),
+    kind      TEXT    NOT NULL,
+    hjid      TEXT    NOT NULL DEFAULT '',
+    type      TEXT    NOT NULL DEFAULT '',
+    path      TEXT    NOT NULL DEFAULT '',
+    line      INTEGER NOT NULL DEFAULT 0,
+    col       INTEGER NOT NULL DEFAULT 0,
+    offset    INTEGER NOT NULL DEFAULT 0,
+    error     TEXT    NOT NULL,
+    fragment  TEXT    NOT NULL DEFAULT ''
+);`,
+		legacy: hasTable("parse_errors"),
+	},
+	{
+		name: "element trees",
+		sql: `
+ALTER TABLE elements ADD COLUMN tree TEXT NOT NULL DEFAULT '';
+ALTER TABLE elements ADD COLUMN seq INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE elements ADD COLUMN container_seq INTEGER NOT NULL DEFAULT 0;
+CREATE TABLE containers (
+    id         INTEGER PRIMARY KEY,
+    import_id  INTEGER REFERENCES imports(id),
+    seq        INTEGER NOT NULL,
+    parent_seq INTEGER NOT NULL DEFAULT 0,
+    name       TEXT    NOT NULL,
+    tree       TEXT    NOT NULL,
+    UNIQUE (import_id, seq)
+);`,
+		legacy: hasTable("containers"),
+	},
+	{
+		name:   "nested data",
+		sql:    `ALTER TABLE elements ADD COLUMN nested TEXT NOT NULL DEFAULT '';`,
+		legacy: hasColumn("elements", "nested"),
+	},
+	{
+		name: "child records",
+		sql: `
+ALTER TABLE elements ADD COLUMN parent_hjid TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_elements_parent ON elements(parent_hjid);`,
+		legacy: hasColumn("elements", "parent_hjid"),
+	},
+	{
+		// The search index holds each element's text values, kept in step
+		// with elements by triggers. Its rowids are the elements' rowids;
+		// REPLACE doesn't fire delete triggers, so a replaced element's
+		// entry is removed before the insert.
+		name: "search index",
+		sql: `
+CREATE VIRTUAL TABLE elements_fts USING fts5(hjid UNINDEXED, type UNINDEXED, text);
+CREATE TRIGGER elements_fts_replace BEFORE INSERT ON elements BEGIN
+    DELETE FROM elements_fts WHERE rowid = (SELECT rowid FROM elements WHERE hjid = new.hjid);
+END;
+CREATE TRIGGER elements_fts_insert AFTER INSERT ON elements BEGIN
+    INSERT INTO elements_fts (rowid, hjid, type, text) VALUES (new.rowid, new.hjid, new.type,
+        (SELECT group_concat(value, ' ') FROM json_tree(new.data) WHERE json_tree.type = 'text'));
+END;
+CREATE TRIGGER elements_fts_delete AFTER DELETE ON elements BEGIN
+    DELETE FROM elements_fts WHERE rowid = old.rowid;
+END;
+CREATE TRIGGER elements_fts_update AFTER UPDATE OF hjid, type, data ON elements BEGIN
+    DELETE FROM elements_fts WHERE rowid = old.rowid;
+    INSERT INTO elements_fts (rowid, hjid, type, text) VALUES (new.rowid, new.hjid, new.type,
+        (SELECT group_concat(value, ' ') FROM json_tree(new.data) WHERE json_tree.type = 'text'));
+END;
+INSERT INTO elements_fts (rowid, hjid, type, text)
+    SELECT rowid, hjid, type,
+        (SELECT group_concat(value, ' ') FROM json_tree(elements.data) WHERE json_tree.type = 'text')
+    FROM elements WHERE json_valid(data);`,
+		legacy: hasTable("elements_fts"),
+	},
+	{
+		// Views for writing ad hoc SQL: one row per field, elements with
+		// the file they came from, and child records with their parents.
+		name: "helper views",
+		sql: `
+CREATE VIEW element_fields AS
+    SELECT e.hjid, e.type, f.key AS field, f.value
+    FROM elements e, json_each(e.data) f;
+CREATE VIEW element_imports AS
+    SELECT e.hjid, e.type, e.import_id, i.name AS import_name, i.started_at AS imported_at
+    FROM elements e LEFT JOIN imports i ON i.id = e.import_id;
+CREATE VIEW element_children AS
+    SELECT p.hjid AS parent_hjid, p.type AS parent_type, c.hjid, c.type, c.data
+    FROM elements c JOIN elements p ON p.hjid = c.parent_hjid;`,
+		legacy: hasView("element_fields"),
+	},
+	{
+		name: "materialised tables",
+		sql: `
+CREATE TABLE materialised (
+    type       TEXT    PRIMARY KEY,
+    table_name TEXT    NOT NULL UNIQUE,
+    columns    INTEGER NOT NULL,
+    built_at   TEXT    NOT NULL
+);`,
+		legacy: hasTable("materialised"),
+	},
+	{
+		// Indexing each element as it is written doubled import times, so
+		// the insert and update triggers now only note the rows to index,
+		// and indexPending indexes them together once an import is done.
+		name: "deferred search index",
+		sql: `
+CREATE TABLE elements_fts_pending (id INTEGER PRIMARY KEY);
+DROP TRIGGER elements_fts_insert;
+DROP TRIGGER elements_fts_update;
+CREATE TRIGGER elements_fts_insert AFTER INSERT ON elements BEGIN
+    INSERT OR IGNORE INTO elements_fts_pending (id) VALUES (new.rowid);
+END;
+CREATE TRIGGER elements_fts_update AFTER UPDATE OF hjid, type, data ON elements BEGIN
+    DELETE FROM elements_fts WHERE rowid = old.rowid;
+    INSERT OR IGNORE INTO elements_fts_pending (id) VALUES (new.rowid);
+END;`,
+		legacy: hasTable("elements_fts_pending"),
+	},
+	{
+		// The triggers each materialised table had on elements were
+		// compiled into every write to it, slowing imports in proportion
+		// to the number of tables. Materialised tables are now brought up
+		// to date with the search index, from the rows noted as written
+		// and, by one trigger, those removed. Connections turn recursive
+		// triggers on, so the delete in INSERT OR REPLACE fires the delete
+		// triggers, and the trigger doing that job for the index goes.
+		name: "deferred materialised tables",
+		sql: `
+DROP TRIGGER elements_fts_replace;
+DROP TRIGGER elements_fts_insert;
+DROP TRIGGER elements_fts_update;
+ALTER TABLE elements_fts_pending RENAME TO elements_pending;
+CREATE TRIGGER elements_pending_insert AFTER INSERT ON elements BEGIN
+    INSERT OR IGNORE INTO elements_pending (id) VALUES (new.rowid);
+END;
+CREATE TRIGGER elements_pending_update AFTER UPDATE OF hjid, type, data ON elements BEGIN
+    DELETE FROM elements_fts WHERE rowid = old.rowid;
+    INSERT INTO materialised_removed (hjid, type)
+        SELECT old.hjid, old.type WHERE old.type IN (SELECT type FROM materialised);
+    INSERT OR IGNORE INTO elements_pending (id) VALUES (new.rowid);
+END;
+CREATE TABLE materialised_removed (
+    hjid TEXT NOT NULL,
+    type TEXT NOT NULL
+);
+CREATE TRIGGER materialised_remove AFTER DELETE ON elements
+WHEN old.type IN (SELECT type FROM materialised) BEGIN
+    INSERT INTO materialised_removed (hjid, type) VALUES (old.hjid, old.type);
+END;`,
+		run:    dropMaterialisedTriggers,
+		legacy: hasTable("materialised_removed"),
+	},
+	{
+		// Stores without materialised tables were paying for triggers
+		// noting removals from them. Materialise now creates those
+		// triggers, and dropping the last table drops them.
+		name: "materialised triggers on demand",
+		sql: `
+DROP TRIGGER materialised_remove;
+DROP TRIGGER elements_pending_update;
+CREATE TRIGGER elements_pending_update AFTER UPDATE OF hjid, type, data ON elements BEGIN
+    DELETE FROM elements_fts WHERE rowid = old.rowid;
+    INSERT OR IGNORE INTO elements_pending (id) VALUES (new.rowid);
+END;`,
+		run:    trackMaterialised,
+		legacy: pendingUpdateLeavesMaterialised,
+	},
+	{
+		// element_versions held every version, the current one included,
+		// a second copy of every element. The current version's metainfo
+		// now lives in elements, and only replaced versions are kept.
+		name: "current version in elements",
+		sql: `
+ALTER TABLE elements ADD COLUMN op_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE elements ADD COLUMN transaction_date TEXT NOT NULL DEFAULT '';
+CREATE TEMP TABLE latest_versions AS
+    SELECT v.id, v.hjid, v.op_type, v.transaction_date FROM element_versions v
+    JOIN (SELECT MAX(id) AS id FROM element_versions GROUP BY hjid) m ON m.id = v.id
+    WHERE v.hjid IN (SELECT hjid FROM elements);
+UPDATE elements SET (op_type, transaction_date) = (
+    SELECT l.op_type, l.transaction_date FROM latest_versions l WHERE l.hjid = elements.hjid
+) WHERE hjid IN (SELECT hjid FROM latest_versions);
+DELETE FROM element_versions WHERE id IN (SELECT id FROM latest_versions);
+DROP TABLE latest_versions;`,
+		legacy: hasColumn("elements", "transaction_date"),
+	},
+}
+
+// dropMaterialisedTriggers drops the triggers materialised tables had on
+// elements.
+func dropMaterialisedTriggers(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT table_name FROM materialised")
+	if err != nil {
+		return fmt.Errorf("listing materialised tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("scanning materialised table: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	err = rows.Err()
+	_ = rows.Close()
+	if err != nil {
+		return fmt.Errorf("listing materialised tables: %w", err)
+	}
+	for _, table := range tables {
+		for _, suffix := range []string{"_retype", "_insert", "_update", "_delete"} {
+			if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + quoteIdent(table+suffix)); err != nil {
+				return fmt.Errorf("dropping %s%s: %w", table, suffix, err)
+			}
+		}
+	}
+	return nil
+}
+
+// latestVersion is the schema version this build of te reads and writes.
+func latestVersion() int {
+	return len(migrations)
+}
+
+const versionTable = `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version    INTEGER PRIMARY KEY,
+    name       TEXT    NOT NULL,
+    applied_at TEXT    NOT NULL
+);`
+
+// migrate brings db up to the latest version, applying each migration it
+// lacks in its own transaction. It refuses databases written by a newer te.
+func migrate(db *sql.DB) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > latestVersion() {
+		return newerSchemaError(version)
+	}
+	if version == 0 {
+		// Databases from before schema_version are brought under it at
+		// the version their tables show.
+		if version, err = legacyVersion(db); err != nil {
+			return err
+		}
+	}
+	if _, err := db.Exec(versionTable); err != nil {
+		return fmt.Errorf("creating schema_version: %w", err)
+	}
+	if err := recordLegacy(db, version); err != nil {
+		return err
+	}
+
+	for v := version + 1; v <= latestVersion(); v++ {
+		if err := applyMigration(db, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTo applies migrations up to version. It is used by tests to build
+// databases as earlier releases left them.
+func migrateTo(db *sql.DB, version int) error {
+	if _, err := db.Exec(versionTable); err != nil {
+		return fmt.Errorf("creating schema_version: %w", err)
+	}
+	for v := 1; v <= version; v++ {
+		if err := applyMigration(db, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, version int) error {
+	m := migrations[version-1]
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning migration %d: %w", version, err)
+	}
+	if _, err := tx.Exec(m.sql); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migrating schema to version %d (%s): %w", version, m.name, err)
+	}
+	if m.run != nil {
+		if err := m.run(tx); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migrating schema to version %d (%s): %w", version, m.name, err)
+		}
+	}
+	if err := setVersion(tx, version); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing migration %d: %w", version, err)
+	}
+	return nil
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func setVersion(db execer, version int) error {
+	_, err := db.Exec(
+		"INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+		version, migrations[version-1].name, timestamp(time.Now()),
+	)
+	if err != nil {
+		return fmt.Errorf("recording schema version %d: %w", version, err)
+	}
+	return nil
+}
+
+// recordLegacy marks the migrations a legacy database already had as
+// applied.
+func recordLegacy(db *sql.DB, version int) error {
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	for v := current + 1; v <= version; v++ {
+		if err := setVersion(db, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns the version recorded in db, or 0 if it has none.
+func schemaVersion(db *sql.DB) (int, error) {
+	ok, err := hasTable("schema_version")(db)
+	if err != nil || !ok {
+		return 0, err
+	}
+	var version sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// legacyVersion works out how far through the migrations a database
+// created without schema_version had got, from the latest change it has.
+func legacyVersion(db *sql.DB) (int, error) {
+	for v := len(migrations); v > 0; v-- {
+		ok, err := migrations[v-1].legacy(db)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return v, nil
+		}
+	}
+	return 0, nil
+}
+
+func newerSchemaError(version int) error {
+	return fmt.Errorf("database schema version %d is newer than this te supports (%d); upgrade te to open it",
+		version, latestVersion())
+}
+
+func hasTable(name string) func(db *sql.DB) (bool, error) {
+	return hasObject("table", name)
+}
+
+func hasView(name string) func(db *sql.DB) (bool, error) {
+	return hasObject("view", name)
+}
+
+// pendingUpdateLeavesMaterialised reports whether elements_pending_update
+// exists and no longer notes removals from materialised tables itself.
+func pendingUpdateLeavesMaterialised(db *sql.DB) (bool, error) {
+	var n int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'elements_pending_update'
+		AND sql NOT LIKE '%materialised_removed%'`,
+	).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("inspecting schema: %w", err)
+	}
+	return n > 0, nil
+}
+
+func hasObject(kind, name string) func(db *sql.DB) (bool, error) {
+	return func(db *sql.DB) (bool, error) {
+		var n int
+		err := db.QueryRow(
+			"SELECT COUNT(*) FROM sqlite_master WHERE type = ? AND name = ?", kind, name,
+		).Scan(&n)
+		if err != nil {
+			return false, fmt.Errorf("inspecting schema: %w", err)
+		}
+		return n > 0, nil
+	}
+}
+
+func hasColumn(table, column string) func(db *sql.DB) (bool, error) {
+	return func(db *sql.DB) (bool, error) {
+		var n int
+		err := db.QueryRow(
+			"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column,
+		).Scan(&n)
+		if err != nil {
+			return false, fmt.Errorf("inspecting %s: %w", table, err)
+		}
+		return n > 0, nil
+	}
+}
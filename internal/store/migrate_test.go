@@ -0,0 +1,240 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// fixture builds a database as the release at version left it, holding an
+// element and, once imports exist, a finished and a cancelled import. With
+// legacy set, schema_version is dropped, as in databases from before it.
+func fixture(t *testing.T, version int, legacy bool) string {
+	t.Helper()
+	path := tempDB(t)
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("opening fixture: %v", err)
+	}
+	defer db.Close() //nolint:errcheck
+
+	if err := migrateTo(db, version); err != nil {
+		t.Fatalf("migrating fixture to %d: %v", version, err)
+	}
+	var stmts []string
+	if version >= 1 {
+		stmts = append(stmts, `INSERT INTO elements (hjid, type, data) VALUES ('1', 'Measure', '{"sid":"1"}')`)
+	}
+	if version >= 2 {
+		stmts = append(stmts,
+			`INSERT INTO imports (name, size, started_at, finished_at) VALUES ('done.xml', 1, 'x', 'y')`,
+			`INSERT INTO imports (name, size, started_at, finished_at) VALUES ('stopped.xml', 1, 'x', 'y')`,
+		)
+	}
+	if version >= 5 {
+		stmts = append(stmts,
+			`UPDATE imports SET status = 'complete' WHERE name = 'done.xml'`,
+			`UPDATE imports SET status = 'cancelled' WHERE name = 'stopped.xml'`,
+		)
+	}
+	if legacy {
+		stmts = append(stmts, "DROP TABLE schema_version")
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("filling fixture: %s: %v", stmt, err)
+		}
+	}
+	return path
+}
+
+func checkUpgraded(t *testing.T, path string, version int) {
+	t.Helper()
+	s, err := OpenWith(path, OpenOptions{Append: true})
+	if err != nil {
+		t.Fatalf("upgrading from version %d: %v", version, err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	if got, err := schemaVersion(s.db); err != nil || got != latestVersion() {
+		t.Errorf("from version %d: schema version %d, %v; want %d", version, got, err, latestVersion())
+	}
+
+	if version >= 1 {
+		if e, err := s.Element("1"); err != nil || e.Data != `{"sid":"1"}` {
+			t.Errorf("from version %d: element = %+v, %v", version, e, err)
+		}
+	}
+	imports, err := s.Imports()
+	if err != nil {
+		t.Fatalf("from version %d: Imports: %v", version, err)
+	}
+	if version >= 2 {
+		want := map[string]string{"done.xml": ImportComplete, "stopped.xml": ImportComplete}
+		if version >= 5 {
+			want["stopped.xml"] = ImportCancelled
+		}
+		for _, im := range imports {
+			if im.Status != want[im.Name] {
+				t.Errorf("from version %d: import %s status %s, want %s", version, im.Name, im.Status, want[im.Name])
+			}
+		}
+	}
+
+	// Every later table and column must be usable.
+	if _, err := s.Containers(); err != nil {
+		t.Errorf("from version %d: Containers: %v", version, err)
+	}
+	if _, err := s.ParseErrors(1); err != nil {
+		t.Errorf("from version %d: ParseErrors: %v", version, err)
+	}
+	if _, err := s.Children("1", 1, 0); err != nil {
+		t.Errorf("from version %d: Children: %v", version, err)
+	}
+	if _, err := s.ElementHistory("1"); err != nil {
+		t.Errorf("from version %d: ElementHistory: %v", version, err)
+	}
+	if version >= 1 {
+		// Elements stored before the search index are indexed by it.
+		if r, err := s.Search("1", "", 10); err != nil || len(r) != 1 || r[0].Hjid != "1" {
+			t.Errorf("from version %d: Search = %+v, %v", version, r, err)
+		}
+	}
+	err = s.PutRecord(Record{Hjid: "2", Type: "Measure", Data: "{}", Nested: "{}", Tree: `["Measure"]`, ParentHjid: "1"})
+	if err != nil {
+		t.Errorf("from version %d: PutRecord: %v", version, err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Errorf("from version %d: Flush: %v", version, err)
+	}
+}
+
+func TestMigrateFromEachVersion(t *testing.T) {
+	for v := 0; v <= latestVersion(); v++ {
+		checkUpgraded(t, fixture(t, v, false), v)
+	}
+}
+
+func TestMigrateLegacyDatabases(t *testing.T) {
+	for v := 1; v <= latestVersion(); v++ {
+		path := fixture(t, v, true)
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			t.Fatalf("opening fixture: %v", err)
+		}
+		got, err := legacyVersion(db)
+		_ = db.Close()
+		if err != nil || got != v {
+			t.Errorf("legacyVersion = %d, %v; want %d", got, err, v)
+		}
+		checkUpgraded(t, path, v)
+	}
+}
+
+func TestMigrateMovesCurrentVersionIntoElements(t *testing.T) {
+	path := fixture(t, 16, false)
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("opening fixture: %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO element_versions (hjid, type, data, op_type, transaction_date) VALUES ('1', 'Measure', '{"sid":"0"}', 'C', '2024-01-01')`,
+		`INSERT INTO element_versions (hjid, type, data, op_type, transaction_date) VALUES ('1', 'Measure', '{"sid":"1"}', 'U', '2024-01-02')`,
+		`INSERT INTO element_versions (hjid, type, data, op_type, transaction_date) VALUES ('9', 'Measure', '{}', 'D', '2024-01-03')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("filling fixture: %v", err)
+		}
+	}
+	_ = db.Close()
+
+	s, err := OpenWith(path, OpenOptions{Append: true})
+	if err != nil {
+		t.Fatalf("upgrading: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	versions, err := s.ElementHistory("1")
+	if err != nil {
+		t.Fatalf("ElementHistory: %v", err)
+	}
+	if len(versions) != 2 || versions[0].OpType != "C" || versions[1].ID != 0 ||
+		versions[1].OpType != "U" || versions[1].TransactionDate != "2024-01-02" {
+		t.Errorf("history of 1 = %+v", versions)
+	}
+	// A deleted element's versions all stay in element_versions.
+	if versions, err := s.ElementHistory("9"); err != nil || len(versions) != 1 || versions[0].OpType != "D" {
+		t.Errorf("history of 9 = %+v, %v", versions, err)
+	}
+}
+
+func TestOpenRefusesNewerSchema(t *testing.T) {
+	path := tempDB(t)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	_, err = s.db.Exec(
+		"INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'future', 'x')", latestVersion()+1,
+	)
+	if err != nil {
+		t.Fatalf("recording future version: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := OpenWith(path, OpenOptions{Append: true}); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("OpenWith = %v, want newer schema error", err)
+	}
+	if _, err := OpenReadOnly(path); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("OpenReadOnly = %v, want newer schema error", err)
+	}
+}
+
+func TestOpenReadOnlyUpgrades(t *testing.T) {
+	path := fixture(t, 1, true)
+	s, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	if _, err := s.NestedData("1"); err != nil {
+		t.Errorf("NestedData after upgrade: %v", err)
+	}
+}
+
+func TestMigrateDropsMaterialisedTriggers(t *testing.T) {
+	path := fixture(t, 14, false)
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("opening fixture: %v", err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE t_Measure (hjid TEXT PRIMARY KEY)",
+		"INSERT INTO materialised (type, table_name, columns, built_at) VALUES ('Measure', 't_Measure', 1, 'x')",
+		`CREATE TRIGGER t_Measure_retype BEFORE INSERT ON elements WHEN new.type != 'Measure' BEGIN
+    DELETE FROM t_Measure WHERE hjid = new.hjid;
+END`,
+		`CREATE TRIGGER t_Measure_insert AFTER INSERT ON elements WHEN new.type = 'Measure' BEGIN
+    INSERT OR REPLACE INTO t_Measure (hjid) VALUES (new.hjid);
+END`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("filling fixture: %s: %v", stmt, err)
+		}
+	}
+	_ = db.Close()
+
+	s, err := OpenWith(path, OpenOptions{Append: true})
+	if err != nil {
+		t.Fatalf("OpenWith: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+	for _, trigger := range []string{"t_Measure_retype", "t_Measure_insert", "elements_fts_replace"} {
+		if ok, err := hasObject("trigger", trigger)(s.db); err != nil || ok {
+			t.Errorf("trigger %s after upgrade: %v, %v", trigger, ok, err)
+		}
+	}
+}
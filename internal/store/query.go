@@ -0,0 +1,419 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Query selects elements of one type with a filter expression over their
+// data. A filter compares fields with =, !=, <, <=, > or >=, tests them
+// with in (...), like or exists, and combines tests with and, or, not and
+// parentheses:
+//
+//	geographicalArea.areaId = "1011" and validityStartDate >= "2024-01-01"
+//	measureType in ("103", "105") and not exists validityEndDate
+//
+// Fields are keys of the flattened data, such as measureComponent[0].sid
+// or geographicalArea.@areaId.
+// Values are quoted strings or numbers; comparing with a number compares
+// the field numerically, and fails for values that aren't numbers, such
+// as dates. A missing field matches no comparison, so passes a negated
+// one: not x = 1, x not in (...) and x not like "..." all select it.
+type Query struct {
+	Type   string
+	Filter string
+	// Fields, when set, limits each result's Data to these fields, as a
+	// JSON object holding null for those missing.
+	Fields []string
+	// Sort orders results by these fields, descending for those prefixed
+	// with -. Results are otherwise ordered by hjid.
+	Sort  []string
+	Limit int // 0 for no limit
+}
+
+// Query returns the elements matching q.
+func (s *Store) Query(q Query) ([]Element, error) {
+	where, args, err := compileFilter(q.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := "data"
+	var columnArgs []interface{}
+	if len(q.Fields) > 0 {
+		var pairs []string
+		for _, f := range q.Fields {
+			path, err := fieldPath(f)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, "?, json_extract(data, ?)")
+			columnArgs = append(columnArgs, f, path)
+		}
+		columns = "json_object(" + strings.Join(pairs, ", ") + ")"
+	}
+
+	stmt := "SELECT hjid, type, " + columns + " FROM elements WHERE type = ?"
+	args = append(append(columnArgs, q.Type), args...)
+	if where != "" {
+		stmt += " AND (" + where + ")"
+	}
+
+	var order []string
+	for _, f := range q.Sort {
+		dir := "ASC"
+		if strings.HasPrefix(f, "-") {
+			f, dir = f[1:], "DESC"
+		}
+		path, err := fieldPath(f)
+		if err != nil {
+			return nil, err
+		}
+		order = append(order, "json_extract(data, ?) "+dir)
+		args = append(args, path)
+	}
+	stmt += " ORDER BY " + strings.Join(append(order, "hjid"), ", ")
+	if q.Limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.Query(stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying elements: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var elements []Element
+	for rows.Next() {
+		var e Element
+		if err := rows.Scan(&e.Hjid, &e.Type, &e.Data); err != nil {
+			return nil, fmt.Errorf("scanning element: %w", err)
+		}
+		elements = append(elements, e)
+	}
+	return elements, rows.Err()
+}
+
+// fieldPath returns the JSON path of a flattened data key. Keys hold dots
+// and brackets, so the whole key is quoted.
+func fieldPath(field string) (string, error) {
+	if field == "" || strings.ContainsAny(field, `"\`) {
+		return "", fmt.Errorf("invalid field name %q", field)
+	}
+	return `$."` + field + `"`, nil
+}
+
+// compileFilter turns a filter expression into an SQL condition on the
+// elements table, with its values as parameters. An empty filter compiles
+// to an empty condition.
+func compileFilter(filter string) (string, []interface{}, error) {
+	tokens, err := lex(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(tokens) == 1 {
+		return "", nil, nil
+	}
+	p := &filterParser{tokens: tokens}
+	where, err := p.or()
+	if err != nil {
+		return "", nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return "", nil, p.errorf(t, "unexpected %s", t)
+	}
+	return where, p.args, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokField
+	tokString
+	tokNumber
+	tokOp
+	tokKeyword
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // column, from 1
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return strconv.Quote(t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+var keywords = map[string]bool{"and": true, "or": true, "not": true, "in": true, "like": true, "exists": true}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", start + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", start + 1})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", start + 1})
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			i++
+			for ; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("filter column %d: unterminated string", start+1)
+			}
+			i++
+			tokens = append(tokens, token{tokString, b.String(), start + 1})
+		case strings.ContainsRune("=!<>", rune(c)):
+			i++
+			if i < len(s) && (s[i] == '=' || (c == '<' && s[i] == '>')) {
+				i++
+			}
+			op := s[start:i]
+			if op == "!" {
+				return nil, fmt.Errorf("filter column %d: unexpected !", start+1)
+			}
+			tokens = append(tokens, token{tokOp, op, start + 1})
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			i++
+			for i < len(s) && (s[i] == '.' || s[i] == 'e' || s[i] == 'E' || (s[i] >= '0' && s[i] <= '9')) {
+				i++
+			}
+			if _, err := strconv.ParseFloat(s[start:i], 64); err != nil {
+				return nil, fmt.Errorf("filter column %d: invalid number %q", start+1, s[start:i])
+			}
+			tokens = append(tokens, token{tokNumber, s[start:i], start + 1})
+		case c == '_' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			for i < len(s) && isFieldChar(s[i]) {
+				i++
+			}
+			word := s[start:i]
+			if keywords[strings.ToLower(word)] {
+				tokens = append(tokens, token{tokKeyword, strings.ToLower(word), start + 1})
+			} else {
+				tokens = append(tokens, token{tokField, word, start + 1})
+			}
+		default:
+			return nil, fmt.Errorf("filter column %d: unexpected %q", start+1, c)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(s) + 1}), nil
+}
+
+func isFieldChar(c byte) bool {
+	return c == '_' || c == '.' || c == '[' || c == ']' || c == ':' || c == '@' || c == '-' ||
+		(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// filterParser compiles tokens by recursive descent; or binds loosest, then
+// and, then not.
+type filterParser struct {
+	tokens []token
+	pos    int
+	args   []interface{}
+}
+
+func (p *filterParser) peek() token { return p.tokens[p.pos] }
+
+func (p *filterParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokKeyword && t.text == word {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("filter column %d: %s", t.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) or() (string, error) {
+	left, err := p.and()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (string, error) {
+	left, err := p.not()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("and") {
+		right, err := p.not()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) not() (string, error) {
+	if p.keyword("not") {
+		operand, err := p.not()
+		if err != nil {
+			return "", err
+		}
+		return negated(operand, true), nil
+	}
+	return p.test()
+}
+
+// negated negates test if negate is set. A missing field fails the test,
+// so passes its negation.
+func negated(test string, negate bool) string {
+	if !negate {
+		return test
+	}
+	return "NOT coalesce(" + test + ", 0)"
+}
+
+func (p *filterParser) test() (string, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokLParen:
+		inner, err := p.or()
+		if err != nil {
+			return "", err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return "", p.errorf(closing, "expected ) but found %s", closing)
+		}
+		return inner, nil
+	case t.kind == tokKeyword && t.text == "exists":
+		f := p.next()
+		if f.kind != tokField {
+			return "", p.errorf(f, "expected a field after exists but found %s", f)
+		}
+		return "json_type(data, " + p.path(f) + ") IS NOT NULL", nil
+	case t.kind != tokField:
+		return "", p.errorf(t, "expected a field but found %s", t)
+	}
+
+	field := p.path(t)
+	negate := p.keyword("not")
+	op := p.next()
+	switch {
+	case op.kind == tokKeyword && op.text == "in":
+		values, err := p.list()
+		if err != nil {
+			return "", err
+		}
+		return negated("json_extract(data, "+field+") IN ("+strings.Join(values, ", ")+")", negate), nil
+	case op.kind == tokKeyword && op.text == "like":
+		v := p.next()
+		if v.kind != tokString {
+			return "", p.errorf(v, "expected a string after like but found %s", v)
+		}
+		return negated("json_extract(data, "+field+") LIKE "+p.bind(v.text), negate), nil
+	case negate:
+		return "", p.errorf(op, "expected in or like after not but found %s", op)
+	case op.kind != tokOp:
+		return "", p.errorf(op, "expected a comparison after %s but found %s", t, op)
+	}
+
+	v := p.next()
+	lhs := "json_extract(data, " + field + ")"
+	switch v.kind {
+	case tokString:
+		return lhs + " " + sqlOp(op.text) + " " + p.bind(v.text), nil
+	case tokNumber:
+		// CAST reads a number from the start of any text, 2024-01-01 as
+		// 2024, so only values that are a number throughout are compared.
+		// Those equal their CAST, as comparing with it converts them; other
+		// text stays text.
+		n, _ := strconv.ParseFloat(v.text, 64)
+		return "(" + lhs + " = CAST(json_extract(data, " + p.path(t) + ") AS NUMERIC)" +
+			" AND CAST(json_extract(data, " + p.path(t) + ") AS REAL) " + sqlOp(op.text) + " " + p.bind(n) + ")", nil
+	default:
+		return "", p.errorf(v, "expected a value after %s but found %s", op.text, v)
+	}
+}
+
+// list parses a parenthesised list of values.
+func (p *filterParser) list() ([]string, error) {
+	if open := p.next(); open.kind != tokLParen {
+		return nil, p.errorf(open, "expected ( after in but found %s", open)
+	}
+	var values []string
+	for {
+		v := p.next()
+		switch v.kind {
+		case tokString, tokNumber:
+			// Data holds text, so numbers in a list match their text.
+			values = append(values, p.bind(v.text))
+		default:
+			return nil, p.errorf(v, "expected a value but found %s", v)
+		}
+		sep := p.next()
+		if sep.kind == tokRParen {
+			return values, nil
+		}
+		if sep.kind != tokComma {
+			return nil, p.errorf(sep, "expected , or ) but found %s", sep)
+		}
+	}
+}
+
+func (p *filterParser) path(t token) string {
+	// Field tokens can't hold quotes or backslashes, so the path is valid.
+	path, _ := fieldPath(t.text)
+	return p.bind(path)
+}
+
+func (p *filterParser) bind(v interface{}) string {
+	p.args = append(p.args, v)
+	return "?"
+}
+
+func sqlOp(op string) string {
+	if op == "<>" {
+		return "!="
+	}
+	return op
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func queryStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	for _, e := range []struct{ hjid, typ, data string }{
+		{"1", "Measure", `{"hjid":"1","geographicalArea.areaId":"1011","validityStartDate":"2024-03-01","measureType":"103","dutyAmount":"9.5"}`},
+		{"2", "Measure", `{"hjid":"2","geographicalArea.areaId":"1011","validityStartDate":"2023-01-01","measureType":"105","dutyAmount":"12","validityEndDate":"2023-12-31"}`},
+		{"3", "Measure", `{"hjid":"3","geographicalArea.areaId":"CN","validityStartDate":"2024-06-01","measureType":"103","dutyAmount":"100"}`},
+		{"4", "Footnote", `{"hjid":"4","geographicalArea.areaId":"1011"}`},
+	} {
+		if err := s.InsertElement(e.hjid, e.typ, e.data); err != nil {
+			t.Fatalf("InsertElement: %v", err)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	return s
+}
+
+func TestQueryFilters(t *testing.T) {
+	s := queryStore(t)
+
+	tests := []struct {
+		filter, want string
+	}{
+		{``, "1,2,3"},
+		{`geographicalArea.areaId = "1011" and validityStartDate >= "2024-01-01"`, "1"},
+		{`geographicalArea.areaId = '1011' or measureType = "103"`, "1,2,3"},
+		{`not geographicalArea.areaId = "1011"`, "3"},
+		{`measureType in ("105", 103)`, "1,2,3"},
+		{`measureType not in ("105")`, "1,3"},
+		{`exists validityEndDate`, "2"},
+		{`not exists validityEndDate and (measureType = "103" or measureType = "105")`, "1,3"},
+		{`validityStartDate like "2024-%"`, "1,3"},
+		{`validityStartDate not like "2024-%"`, "2"},
+		{`dutyAmount > 10`, "2,3"},
+		{`dutyAmount <= 9.5`, "1"},
+		{`dutyAmount != "12"`, "1,3"},
+		{`missing = "x" or missing != "x"`, ""},
+		{`NOT missing = "x"`, "1,2,3"},
+	}
+	for _, tt := range tests {
+		elements, err := s.Query(Query{Type: "Measure", Filter: tt.filter})
+		if err != nil {
+			t.Errorf("Query(%s): %v", tt.filter, err)
+			continue
+		}
+		var got []string
+		for _, e := range elements {
+			got = append(got, e.Hjid)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("Query(%s) = %v, want %s", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestQueryNumbersAndMissingFields(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	for hjid, data := range map[string]string{
+		"1": `{"sid":"0"}`,
+		"2": `{"sid":"abc"}`,
+		"3": `{"sid":"-1.5e1"}`,
+		"4": `{}`,
+		"5": `{"sid":"2024-01-01"}`,
+		"6": `{"sid":"0101"}`,
+	} {
+		if err := s.InsertElement(hjid, "Measure", data); err != nil {
+			t.Fatalf("InsertElement: %v", err)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	tests := []struct {
+		filter, want string
+	}{
+		{`sid = 0`, "1"},
+		{`sid < 0`, "3"},
+		{`sid != 0`, "3,6"},
+		{`not sid = 0`, "2,3,4,5,6"},
+		{`sid not like "a%"`, "1,3,4,5,6"},
+		{`not sid like "a%"`, "1,3,4,5,6"},
+		{`sid not in ("0")`, "2,3,4,5,6"},
+		// A date isn't a number, though it starts with one.
+		{`sid > 100`, "6"},
+		{`sid >= 2024`, ""},
+	}
+	for _, tt := range tests {
+		elements, err := s.Query(Query{Type: "Measure", Filter: tt.filter})
+		if err != nil {
+			t.Errorf("Query(%s): %v", tt.filter, err)
+			continue
+		}
+		var got []string
+		for _, e := range elements {
+			got = append(got, e.Hjid)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("Query(%s) = %v, want %s", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestQueryFieldsSortAndLimit(t *testing.T) {
+	s := queryStore(t)
+
+	elements, err := s.Query(Query{
+		Type:   "Measure",
+		Fields: []string{"validityStartDate", "validityEndDate"},
+		Sort:   []string{"-validityStartDate"},
+		Limit:  2,
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(elements) != 2 {
+		t.Fatalf("got %d elements, want 2", len(elements))
+	}
+	if elements[0].Hjid != "3" || elements[0].Data != `{"validityStartDate":"2024-06-01","validityEndDate":null}` {
+		t.Errorf("first = %+v", elements[0])
+	}
+	if elements[1].Hjid != "1" {
+		t.Errorf("second = %+v, want hjid 1", elements[1])
+	}
+}
+
+func TestQueryBindsValues(t *testing.T) {
+	s := queryStore(t)
+
+	elements, err := s.Query(Query{Type: "Measure", Filter: `measureType = "103' OR '1'='1"`})
+	if err != nil || len(elements) != 0 {
+		t.Errorf("injected filter = %v, %v; want no elements", elements, err)
+	}
+	if _, err := s.Query(Query{Type: "Measure", Fields: []string{`a"b`}}); err == nil {
+		t.Error("expected an error for a field with a quote")
+	}
+}
+
+func TestQueryFilterErrors(t *testing.T) {
+	s := queryStore(t)
+
+	tests := []struct {
+		filter, want string
+	}{
+		{`sid =`, "column 6: expected a value after = but found end of filter"},
+		{`sid = "1`, "column 7: unterminated string"},
+		{`sid "1"`, `column 5: expected a comparison after "sid" but found "1"`},
+		{`(sid = "1"`, "column 11: expected ) but found end of filter"},
+		{`sid = "1" sid`, `column 11: unexpected "sid"`},
+		{`sid in "1"`, `column 8: expected ( after in but found "1"`},
+		{`sid like 1`, "column 10: expected a string after like"},
+		{`exists "sid"`, "column 8: expected a field after exists"},
+		{`sid = 1.2.3`, "column 7: invalid number"},
+		{`sid ! "1"`, "column 5: unexpected !"},
+		{`sid not = "1"`, "column 9: expected in or like after not"},
+		{`and`, `column 1: expected a field but found "and"`},
+	}
+	for _, tt := range tests {
+		_, err := s.Query(Query{Type: "Measure", Filter: tt.filter})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Query(%s) = %v, want error containing %q", tt.filter, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxExamples is how many example values InferSchema keeps per field.
+const maxExamples = 3
+
+// TypeSchema describes the fields found in one element type's data.
+type TypeSchema struct {
+	Type     string        `json:"type"`
+	Elements int           `json:"elements"`
+	Fields   []FieldSchema `json:"fields"`
+}
+
+// FieldSchema summarises the values of one field across a type's elements.
+type FieldSchema struct {
+	Path string `json:"path"`
+	// Types are the JSON types seen, such as string, integer or null, in
+	// alphabetical order.
+	Types []string `json:"types"`
+	// Present counts the elements with the field, Nulls those where it is
+	// null.
+	Present int `json:"present"`
+	Nulls   int `json:"nulls"`
+	// Distinct counts the different non-null values.
+	Distinct  int `json:"distinct"`
+	MinLength int `json:"minLength"`
+	MaxLength int `json:"maxLength"`
+	// Format is what every non-null value looks like, whatever its JSON
+	// type: integer, number, boolean, date or date-time, or empty for
+	// anything else.
+	Format string `json:"format,omitempty"`
+	// Examples are the most common values, most common first.
+	Examples []string `json:"examples,omitempty"`
+}
+
+// Required reports whether every element of the type has a non-null value
+// for the field.
+func (f FieldSchema) Required(elements int) bool {
+	return f.Present == elements && f.Nulls == 0
+}
+
+// Conditions on a json_each value f having the shape of a format. Numbers
+// must read back unchanged, so codes with leading zeros stay text.
+const (
+	integerValue  = "CAST(CAST(f.value AS INTEGER) AS TEXT) = CAST(f.value AS TEXT)"
+	realValue     = "CAST(CAST(f.value AS REAL) AS TEXT) = CAST(f.value AS TEXT)"
+	booleanValue  = "(f.type IN ('true', 'false') OR f.value IN ('true', 'false'))"
+	dateValue     = "f.value GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]'"
+	dateTimeValue = "f.value GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]T[0-9][0-9]:[0-9][0-9]:[0-9][0-9]*'"
+)
+
+// jsonTypes names SQLite's json_each types as JSON Schema does.
+var jsonTypes = map[string]string{
+	"text":    "string",
+	"integer": "integer",
+	"real":    "number",
+	"true":    "boolean",
+	"false":   "boolean",
+	"null":    "null",
+	"object":  "object",
+	"array":   "array",
+}
+
+// InferSchema scans every element of a type and describes each field in
+// their data, ordered by path.
+func (s *Store) InferSchema(elementType string) (TypeSchema, error) {
+	ts := TypeSchema{Type: elementType}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM elements WHERE type = ?", elementType).Scan(&ts.Elements); err != nil {
+		return ts, fmt.Errorf("counting %s elements: %w", elementType, err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT f.key, group_concat(DISTINCT f.type), COUNT(*), SUM(f.type = 'null'),
+		       COUNT(DISTINCT f.value), COALESCE(MIN(length(f.value)), 0), COALESCE(MAX(length(f.value)), 0),
+		       COALESCE(SUM(`+booleanValue+`), 0),
+		       COALESCE(SUM(`+integerValue+`), 0),
+		       COALESCE(SUM(`+integerValue+` OR `+realValue+`), 0),
+		       COALESCE(SUM(`+dateValue+`), 0),
+		       COALESCE(SUM(`+dateValue+` OR `+dateTimeValue+`), 0)
+		FROM elements e, json_each(e.data) f
+		WHERE e.type = ?
+		GROUP BY f.key ORDER BY f.key`, elementType)
+	if err != nil {
+		return ts, fmt.Errorf("inferring %s schema: %w", elementType, err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	index := map[string]int{}
+	for rows.Next() {
+		var f FieldSchema
+		var types string
+		var booleans, integers, numbers, dates, dateTimes int
+		err := rows.Scan(&f.Path, &types, &f.Present, &f.Nulls, &f.Distinct, &f.MinLength, &f.MaxLength,
+			&booleans, &integers, &numbers, &dates, &dateTimes)
+		if err != nil {
+			return ts, fmt.Errorf("scanning field: %w", err)
+		}
+		if values := f.Present - f.Nulls; values > 0 {
+			switch values {
+			case booleans:
+				f.Format = "boolean"
+			case integers:
+				f.Format = "integer"
+			case numbers:
+				f.Format = "number"
+			case dates:
+				f.Format = "date"
+			case dateTimes:
+				f.Format = "date-time"
+			}
+		}
+		seen := map[string]bool{}
+		for _, t := range strings.Split(types, ",") {
+			if name := jsonTypes[t]; !seen[name] {
+				seen[name] = true
+				f.Types = append(f.Types, name)
+			}
+		}
+		sort.Strings(f.Types)
+		index[f.Path] = len(ts.Fields)
+		ts.Fields = append(ts.Fields, f)
+	}
+	if err := rows.Err(); err != nil {
+		return ts, fmt.Errorf("inferring %s schema: %w", elementType, err)
+	}
+	if err := rows.Close(); err != nil {
+		return ts, fmt.Errorf("inferring %s schema: %w", elementType, err)
+	}
+
+	examples, err := s.db.Query(`
+		SELECT key, value FROM (
+		    SELECT key, value, row_number() OVER (PARTITION BY key ORDER BY n DESC, value) AS rank
+		    FROM (
+		        SELECT key, value, COUNT(*) AS n FROM (
+		            SELECT f.key,
+		                   CASE WHEN f.type IN ('true', 'false') THEN f.type ELSE CAST(f.value AS TEXT) END AS value
+		            FROM elements e, json_each(e.data) f
+		            WHERE e.type = ? AND f.type != 'null'
+		        ) GROUP BY key, value
+		    )
+		) WHERE rank <= ? ORDER BY key, rank`, elementType, maxExamples)
+	if err != nil {
+		return ts, fmt.Errorf("sampling %s values: %w", elementType, err)
+	}
+	defer examples.Close() //nolint:errcheck
+
+	for examples.Next() {
+		var key, value string
+		if err := examples.Scan(&key, &value); err != nil {
+			return ts, fmt.Errorf("scanning example: %w", err)
+		}
+		f := &ts.Fields[index[key]]
+		f.Examples = append(f.Examples, value)
+	}
+	return ts, examples.Err()
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInferSchema(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	for _, e := range []struct{ hjid, data string }{
+		{"1", `{"sid":"10","code":"0101","note":null,"start":"2024-01-01","flag":"true"}`},
+		{"2", `{"sid":"11","code":"0101","amount":9.5,"start":"2024-01-01T10:00:00","flag":false}`},
+		{"3", `{"sid":"12","code":"020304","amount":12,"start":"2024-02-01"}`},
+	} {
+		if err := s.InsertElement(e.hjid, "Measure", e.data); err != nil {
+			t.Fatalf("InsertElement: %v", err)
+		}
+	}
+	if err := s.InsertElement("4", "Footnote", `{"text":"x"}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	got, err := s.InferSchema("Measure")
+	if err != nil {
+		t.Fatalf("InferSchema: %v", err)
+	}
+	want := TypeSchema{
+		Type:     "Measure",
+		Elements: 3,
+		Fields: []FieldSchema{
+			{Path: "amount", Types: []string{"integer", "number"}, Present: 2, Distinct: 2, MinLength: 2, MaxLength: 3, Format: "number", Examples: []string{"12", "9.5"}},
+			{Path: "code", Types: []string{"string"}, Present: 3, Distinct: 2, MinLength: 4, MaxLength: 6, Examples: []string{"0101", "020304"}},
+			{Path: "flag", Types: []string{"boolean", "string"}, Present: 2, Distinct: 2, MinLength: 1, MaxLength: 4, Format: "boolean", Examples: []string{"false", "true"}},
+			{Path: "note", Types: []string{"null"}, Present: 1, Nulls: 1},
+			{Path: "sid", Types: []string{"string"}, Present: 3, Distinct: 3, MinLength: 2, MaxLength: 2, Format: "integer", Examples: []string{"10", "11", "12"}},
+			{Path: "start", Types: []string{"string"}, Present: 3, Distinct: 3, MinLength: 10, MaxLength: 19, Format: "date-time", Examples: []string{"2024-01-01", "2024-01-01T10:00:00", "2024-02-01"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InferSchema =\n%+v\nwant\n%+v", got, want)
+	}
+
+	required := map[string]bool{}
+	for _, f := range got.Fields {
+		required[f.Path] = f.Required(got.Elements)
+	}
+	if !reflect.DeepEqual(required, map[string]bool{"amount": false, "code": true, "flag": false, "note": false, "sid": true, "start": true}) {
+		t.Errorf("required = %v", required)
+	}
+
+	if got, err := s.InferSchema("Missing"); err != nil || got.Elements != 0 || len(got.Fields) != 0 {
+		t.Errorf("InferSchema(Missing) = %+v, %v", got, err)
+	}
+}
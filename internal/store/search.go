@@ -0,0 +1,130 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SearchResult is an element matching a full-text search, with the text
+// around the match. Lower ranks are better matches.
+type SearchResult struct {
+	Hjid    string
+	Type    string
+	Snippet string
+	Rank    float64
+}
+
+// Search finds elements whose values contain every term of query, best
+// matches first. Terms may be quoted to match a phrase, end in * to match a
+// prefix, or be combined with AND, OR and NOT. An empty elementType searches
+// every type.
+func (s *Store) Search(query, elementType string, limit int) ([]SearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	stmt := `
+		SELECT hjid, type, snippet(elements_fts, 2, '[', ']', '…', 12), rank
+		FROM elements_fts WHERE elements_fts MATCH ?`
+	args := []interface{}{match}
+	if elementType != "" {
+		stmt += " AND type = ?"
+		args = append(args, elementType)
+	}
+	stmt += " ORDER BY rank LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("searching elements: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(&r.Hjid, &r.Type, &r.Snippet, &r.Rank); err != nil {
+			return nil, fmt.Errorf("scanning search result: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// indexPending adds the elements noted in elements_pending to the search
+// index.
+func indexPending(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		INSERT INTO elements_fts (rowid, hjid, type, text)
+		SELECT e.rowid, e.hjid, e.type,
+			(SELECT group_concat(value, ' ') FROM json_tree(e.data) WHERE json_tree.type = 'text')
+		FROM elements_pending p JOIN elements e ON e.rowid = p.id
+		WHERE json_valid(e.data)`)
+	if err != nil {
+		return fmt.Errorf("indexing elements: %w", err)
+	}
+	return nil
+}
+
+// ftsQuery turns a search into an FTS5 query, quoting each term so
+// punctuation such as the dashes in dates is matched rather than parsed.
+// Operators join the terms either side of them, so one at either end is
+// dropped and of several in a row only the last is kept: "a AND NOT b"
+// becomes "a NOT b".
+func ftsQuery(query string) string {
+	var terms []string
+	operator := ""
+	for _, term := range splitTerms(query) {
+		if isOperator(term) {
+			operator = term
+			continue
+		}
+		if operator != "" && len(terms) > 0 {
+			terms = append(terms, operator)
+		}
+		operator = ""
+		if strings.HasSuffix(term, "*") && len(term) > 1 {
+			terms = append(terms, quoteTerm(strings.TrimSuffix(term, "*"))+"*")
+		} else {
+			terms = append(terms, quoteTerm(term))
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// splitTerms splits a query at spaces, keeping double-quoted phrases whole
+// without their quotes.
+func splitTerms(query string) []string {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+	flush := func() {
+		if term.Len() > 0 {
+			terms = append(terms, term.String())
+			term.Reset()
+		}
+	}
+	for _, r := range query {
+		switch {
+		case r == '"':
+			flush()
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			flush()
+		default:
+			term.WriteRune(r)
+		}
+	}
+	flush()
+	return terms
+}
+
+func quoteTerm(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+}
+
+func isOperator(term string) bool {
+	return term == "AND" || term == "OR" || term == "NOT"
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFTSQuery(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"frozen fish", `"frozen" "fish"`},
+		{`"frozen fish" OR chilled`, `"frozen fish" OR "chilled"`},
+		{"2021-01-01", `"2021-01-01"`},
+		{"fro*", `"fro"*`},
+		{"fish NOT", `"fish"`},
+		{"OR fish", `"fish"`},
+		{"a OR OR b", `"a" OR "b"`},
+		{"fish AND NOT chips", `"fish" NOT "chips"`},
+		{`say "hi""`, `"say" "hi"`},
+		{"  ", ""},
+	}
+	for _, tt := range tests {
+		if got := ftsQuery(tt.in); got != tt.want {
+			t.Errorf("ftsQuery(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	for _, r := range []Record{
+		{Hjid: "1", Type: "Measure", Data: `{"description":"Frozen fish fillets","validityStartDate":"2021-01-01"}`},
+		{Hjid: "2", Type: "Footnote", Data: `{"description":"Fish, frozen or chilled"}`},
+		{Hjid: "3", Type: "Measure", Data: `{"description":"Live horses"}`},
+	} {
+		if err := s.PutRecord(r); err != nil {
+			t.Fatalf("PutRecord: %v", err)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	hjids := func(query, typ string) string {
+		t.Helper()
+		results, err := s.Search(query, typ, 10)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", query, err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Hjid)
+		}
+		return strings.Join(got, ",")
+	}
+
+	if got := hjids("frozen fish", ""); got != "1,2" && got != "2,1" {
+		t.Errorf("frozen fish = %s, want 1 and 2", got)
+	}
+	if got := hjids("frozen", "Footnote"); got != "2" {
+		t.Errorf("frozen in Footnote = %s, want 2", got)
+	}
+	if got := hjids("2021-01-01", ""); got != "1" {
+		t.Errorf("date = %s, want 1", got)
+	}
+	if got := hjids("hors*", ""); got != "3" {
+		t.Errorf("prefix = %s, want 3", got)
+	}
+	if got := hjids("fish NOT fillets", ""); got != "2" {
+		t.Errorf("fish NOT fillets = %s, want 2", got)
+	}
+
+	results, err := s.Search("horses", "", 10)
+	if err != nil || len(results) != 1 || results[0].Snippet != "Live [horses]" {
+		t.Errorf("snippet = %+v, %v", results, err)
+	}
+
+	// Replacing and deleting elements keeps the index in step.
+	if err := s.PutRecord(Record{Hjid: "3", Type: "Measure", Data: `{"description":"Live cattle"}`}); err != nil {
+		t.Fatalf("PutRecord: %v", err)
+	}
+	if err := s.DeleteRecord(Record{Hjid: "2", Type: "Footnote"}); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := hjids("horses", ""); got != "" {
+		t.Errorf("horses after replace = %s, want none", got)
+	}
+	if got := hjids("cattle", ""); got != "3" {
+		t.Errorf("cattle = %s, want 3", got)
+	}
+	if got := hjids("chilled", ""); got != "" {
+		t.Errorf("chilled after delete = %s, want none", got)
+	}
+}
+
+func TestSearchIndexesImportWhenItEnds(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	if _, err := s.BeginImport("doc.xml", -1); err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	if err := s.PutRecord(Record{Hjid: "1", Type: "Measure", Data: `{"description":"Frozen fish"}`}); err != nil {
+		t.Fatalf("PutRecord: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if r, err := s.Search("fish", "", 10); err != nil || len(r) != 0 {
+		t.Errorf("Search during the import = %+v, %v; want nothing yet", r, err)
+	}
+
+	if err := s.FinishImport(""); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+	if r, err := s.Search("fish", "", 10); err != nil || len(r) != 1 || r[0].Hjid != "1" {
+		t.Errorf("Search after the import = %+v, %v", r, err)
+	}
+}
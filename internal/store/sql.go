@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ResultWriter receives the result of a statement run by SQL: its columns
+// once, then each row.
+type ResultWriter interface {
+	Columns(names []string) error
+	Row(values []interface{}) error
+}
+
+// SQL runs an ad hoc statement and writes its result to w. Values are
+// int64, float64, string, []byte or nil. A statement returning no rows,
+// such as an UPDATE, writes no columns. Stores opened with OpenReadOnly
+// refuse statements that write, and ATTACH.
+func (s *Store) SQL(w ResultWriter, query string, args ...interface{}) error {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("running query: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// Attaching another database would let a read-only store write to it.
+	if s.readOnly {
+		if _, err := sqlite.Limit(conn, sqlite3.SQLITE_LIMIT_ATTACHED, 0); err != nil {
+			return fmt.Errorf("running query: %w", err)
+		}
+	}
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("running query: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("reading columns: %w", err)
+	}
+	if len(columns) == 0 {
+		return rows.Err()
+	}
+	if err := w.Columns(columns); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+		if err := w.Row(values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("running query: %w", err)
+	}
+	return nil
+}
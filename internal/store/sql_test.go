@@ -0,0 +1,134 @@
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type collect struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+func (c *collect) Columns(names []string) error {
+	c.columns = names
+	return nil
+}
+
+func (c *collect) Row(values []interface{}) error {
+	c.rows = append(c.rows, append([]interface{}(nil), values...))
+	return nil
+}
+
+func TestSQLHelperViews(t *testing.T) {
+	path := tempDB(t)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := s.BeginImport("a.xml", 1); err != nil {
+		t.Fatalf("BeginImport: %v", err)
+	}
+	for _, r := range []Record{
+		{Hjid: "1", Type: "Measure", Data: `{"sid":"10","code":"x"}`},
+		{Hjid: "2", Type: "MeasureComponent", Data: `{"sid":"20"}`, ParentHjid: "1"},
+	} {
+		if err := s.PutRecord(r); err != nil {
+			t.Fatalf("PutRecord: %v", err)
+		}
+	}
+	if err := s.FinishImport(""); err != nil {
+		t.Fatalf("FinishImport: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	tests := []struct {
+		query   string
+		columns []string
+		rows    [][]interface{}
+	}{
+		{
+			"SELECT hjid, field, value FROM element_fields WHERE type = 'Measure' ORDER BY field",
+			[]string{"hjid", "field", "value"},
+			[][]interface{}{{"1", "code", "x"}, {"1", "sid", "10"}},
+		},
+		{
+			"SELECT hjid, import_name FROM element_imports ORDER BY hjid",
+			[]string{"hjid", "import_name"},
+			[][]interface{}{{"1", "a.xml"}, {"2", "a.xml"}},
+		},
+		{
+			"SELECT parent_hjid, parent_type, hjid, type FROM element_children",
+			[]string{"parent_hjid", "parent_type", "hjid", "type"},
+			[][]interface{}{{"1", "Measure", "2", "MeasureComponent"}},
+		},
+		{
+			"SELECT COUNT(*) AS n, NULL AS none FROM elements",
+			[]string{"n", "none"},
+			[][]interface{}{{int64(2), nil}},
+		},
+	}
+	for _, tt := range tests {
+		var c collect
+		if err := s.SQL(&c, tt.query); err != nil {
+			t.Errorf("SQL(%s): %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.columns, tt.columns) || !reflect.DeepEqual(c.rows, tt.rows) {
+			t.Errorf("SQL(%s) = %v %v, want %v %v", tt.query, c.columns, c.rows, tt.columns, tt.rows)
+		}
+	}
+
+	err = s.SQL(&collect{}, "DELETE FROM elements")
+	if err == nil || !strings.Contains(err.Error(), "readonly") {
+		t.Errorf("DELETE on a read-only store = %v, want readonly error", err)
+	}
+}
+
+func TestSQLReadOnlyRefusesAttach(t *testing.T) {
+	path := tempDB(t)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	other := filepath.Join(t.TempDir(), "other.db")
+	o, err := Open(other)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+
+	for _, query := range []string{
+		"ATTACH DATABASE '" + other + "' AS other",
+		"ATTACH DATABASE '" + other + "' AS other; DELETE FROM other.imports",
+		"ATTACH DATABASE '" + filepath.Join(t.TempDir(), "new.db") + "' AS other",
+	} {
+		if err := s.SQL(&collect{}, query); err == nil {
+			t.Errorf("SQL(%s) on a read-only store succeeded, want an error", query)
+		}
+	}
+	if err := s.SQL(&collect{}, "CREATE TEMP TABLE scratch (x)"); err == nil {
+		t.Error("CREATE TEMP TABLE on a read-only store succeeded, want an error")
+	}
+}
@@ -3,23 +3,13 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 
 	_ "modernc.org/sqlite"
 )
 
-const schema = `
-CREATE TABLE IF NOT EXISTS elements (
-    hjid       TEXT    PRIMARY KEY,
-    type       TEXT    NOT NULL,
-    data       TEXT    NOT NULL
-);
-CREATE INDEX IF NOT EXISTS idx_elements_type ON elements(type);
-CREATE VIEW IF NOT EXISTS type_counts AS
-    SELECT type, COUNT(*) AS count FROM elements GROUP BY type ORDER BY count DESC;
-`
-
 const batchSize = 10000
 
 type TypeCount struct {
@@ -31,13 +21,91 @@ type Element struct {
 	Hjid string
 	Type string
 	Data string
+	// Source is the name of the import the element was last written by.
+	// It is only populated by Element.
+	Source string
+}
+
+// BadRecord is a record the parser couldn't store, quarantined with the raw
+// XML it was read from.
+type BadRecord struct {
+	Kind     string // why it was rejected, e.g. malformed or duplicate
+	Hjid     string
+	Type     string
+	Path     string
+	Line     int
+	Column   int
+	Offset   int64
+	Error    string
+	Fragment string
+	// ParentHjid is set on a child record split out of its parent, which
+	// isn't counted as a record read from the source.
+	ParentHjid string
+}
+
+// Record is an element as written by the parser, together with the metainfo
+// fields kept in its version history.
+type Record struct {
+	Hjid            string
+	Type            string
+	Data            string
+	OpType          string
+	TransactionDate string
+	// ParentHjid is set on a child record split out of its parent.
+	ParentHjid string
+	// Nested is Data before child elements were flattened into dotted
+	// keys, keeping the element's hierarchy.
+	Nested string
+	// Tree is the element as read, in JsonML, so it can be exported back
+	// to XML.
+	Tree string
+	// Seq is the record's position in its document, counting from 1, and
+	// Container the seq of the Container it sits in (0 for none).
+	Seq       int64
+	Container int64
 }
 
 type Store struct {
-	db    *sql.DB
-	tx    *sql.Tx
-	stmt  *sql.Stmt
-	count int
+	db      *sql.DB
+	tx      *sql.Tx
+	insStmt *sql.Stmt
+	stmt    *sql.Stmt
+	delStmt *sql.Stmt
+	subStmt *sql.Stmt
+	arcStmt *sql.Stmt
+	verStmt *sql.Stmt
+	badStmt *sql.Stmt
+	count   int
+	// readOnly is set on stores opened with OpenReadOnly.
+	readOnly bool
+	// hasChildren is set once the store holds rows split out of another,
+	// so that until then writes skip looking for children to remove.
+	hasChildren bool
+
+	importID int64
+	inserted int
+	deleted  int
+	rejected int
+	// batchInserted, batchDeleted and batchRejected count the writes in
+	// the open batch, which are discounted if it is rolled back.
+	batchInserted int
+	batchDeleted  int
+	batchRejected int
+	// records counts the source records written in the current import,
+	// excluding rows split out of them; batchRecords those in the open
+	// batch.
+	records      int
+	batchRecords int
+	// checkpoint reports how far through its source the current import
+	// has read, saved with each batch commit.
+	checkpoint func() (bytes int64, checksum string)
+}
+
+// OpenOptions controls how Open prepares an existing database.
+type OpenOptions struct {
+	// Append keeps previously imported elements so a new file is layered
+	// on top of them. By default the database is cleared.
+	Append bool
 }
 
 func DefaultPath() string {
@@ -45,13 +113,30 @@ func DefaultPath() string {
 	return filepath.Join(home, ".cache", "te", "tariff.db")
 }
 
+// dataSource is the driver's name for the database at path, with extra
+// URI parameters. Recursive triggers are turned on for every connection,
+// so the delete INSERT OR REPLACE makes fires the delete triggers that
+// keep the search index and materialised tables in step. The path is
+// escaped, so a ? or # in it isn't read as the start of the parameters.
+func dataSource(path, params string) string {
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=recursive_triggers(1)"
+	if params != "" {
+		dsn += "&" + params
+	}
+	return dsn
+}
+
 func Open(path string) (*Store, error) {
+	return OpenWith(path, OpenOptions{})
+}
+
+func OpenWith(path string, opts OpenOptions) (*Store, error) {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, fmt.Errorf("creating directory %s: %w", dir, err)
 	}
 
-	db, err := sql.Open("sqlite", path)
+	db, err := sql.Open("sqlite", dataSource(path, ""))
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
@@ -61,32 +146,65 @@ func Open(path string) (*Store, error) {
 		return nil, fmt.Errorf("setting WAL mode: %w", err)
 	}
 
-	if _, err := db.Exec(schema); err != nil {
+	if err := migrate(db); err != nil {
 		_ = db.Close()
-		return nil, fmt.Errorf("applying schema: %w", err)
+		return nil, err
 	}
 
-	if _, err := db.Exec("DELETE FROM elements"); err != nil {
-		_ = db.Close()
-		return nil, fmt.Errorf("clearing elements: %w", err)
+	if !opts.Append {
+		if _, err := db.Exec("DELETE FROM elements; DELETE FROM element_versions; DELETE FROM parse_errors; DELETE FROM containers; DELETE FROM imports"); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("clearing elements: %w", err)
+		}
 	}
 
 	s := &Store{db: db}
-	if err := s.beginBatch(); err != nil {
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM elements WHERE parent_hjid != '')").Scan(&s.hasChildren); err != nil {
 		_ = db.Close()
-		return nil, err
+		return nil, fmt.Errorf("checking for split records: %w", err)
 	}
 
+	// Catch up on anything an interrupted import left pending.
+	if err := s.syncPending(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 	return s, nil
 }
 
+// OpenReadOnly opens a database for reading. A database from an older
+// release is upgraded first, which needs write access; one written by a
+// newer release is refused, since its schema isn't understood.
 func OpenReadOnly(path string) (*Store, error) {
-	db, err := sql.Open("sqlite", path+"?mode=ro")
+	// query_only refuses writes to attached databases too, which mode=ro
+	// alone doesn't.
+	db, err := sql.Open("sqlite", dataSource(path, "mode=ro&_pragma=query_only(1)"))
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
 
-	return &Store{db: db}, nil
+	version, err := schemaVersion(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	if version > latestVersion() {
+		_ = db.Close()
+		return nil, newerSchemaError(version)
+	}
+	if version < latestVersion() {
+		_ = db.Close()
+		s, err := OpenWith(path, OpenOptions{Append: true})
+		if err != nil {
+			return nil, fmt.Errorf("upgrading database: %w", err)
+		}
+		if err := s.Close(); err != nil {
+			return nil, fmt.Errorf("upgrading database: %w", err)
+		}
+		return OpenReadOnly(path)
+	}
+
+	return &Store{db: db, readOnly: true}, nil
 }
 
 func (s *Store) beginBatch() error {
@@ -95,51 +213,403 @@ func (s *Store) beginBatch() error {
 		return fmt.Errorf("beginning transaction: %w", err)
 	}
 
-	stmt, err := tx.Prepare("INSERT OR REPLACE INTO elements (hjid, type, data) VALUES (?, ?, ?)")
+	// insStmt adds a new element. An element already stored is left for
+	// stmt to replace, once its version has been archived.
+	insStmt, err := tx.Prepare(`INSERT INTO elements
+		(hjid, type, data, import_id, tree, seq, container_seq, nested, parent_hjid, op_type, transaction_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (hjid) DO NOTHING`)
 	if err != nil {
 		_ = tx.Rollback()
 		return fmt.Errorf("preparing insert: %w", err)
 	}
 
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO elements
+		(hjid, type, data, import_id, tree, seq, container_seq, nested, parent_hjid, op_type, transaction_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		_ = insStmt.Close()
+		_ = tx.Rollback()
+		return fmt.Errorf("preparing replace: %w", err)
+	}
+
+	delStmt, err := tx.Prepare("DELETE FROM elements WHERE hjid = ?")
+	if err != nil {
+		_ = insStmt.Close()
+		_ = stmt.Close()
+		_ = tx.Rollback()
+		return fmt.Errorf("preparing delete: %w", err)
+	}
+
+	// subStmt finds the records split out of an element, to remove them
+	// before it is replaced or deleted. Unlike a DELETE, a SELECT doesn't
+	// compile the triggers on elements, which the driver does on every
+	// execution.
+	subStmt, err := tx.Prepare("SELECT hjid FROM elements WHERE parent_hjid = ?")
+	if err != nil {
+		_ = insStmt.Close()
+		_ = stmt.Close()
+		_ = delStmt.Close()
+		_ = tx.Rollback()
+		return fmt.Errorf("preparing child delete: %w", err)
+	}
+
+	// arcStmt moves an element's current version into its history before
+	// the element is replaced or deleted.
+	arcStmt, err := tx.Prepare(`INSERT INTO element_versions
+		(hjid, type, data, op_type, transaction_date, import_id)
+		SELECT hjid, type, data, op_type, transaction_date, import_id FROM elements WHERE hjid = ?`)
+	if err != nil {
+		_ = insStmt.Close()
+		_ = stmt.Close()
+		_ = delStmt.Close()
+		_ = subStmt.Close()
+		_ = tx.Rollback()
+		return fmt.Errorf("preparing version archive: %w", err)
+	}
+
+	verStmt, err := tx.Prepare(`INSERT INTO element_versions
+		(hjid, type, data, op_type, transaction_date, import_id) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		_ = insStmt.Close()
+		_ = stmt.Close()
+		_ = delStmt.Close()
+		_ = subStmt.Close()
+		_ = arcStmt.Close()
+		_ = tx.Rollback()
+		return fmt.Errorf("preparing version insert: %w", err)
+	}
+
+	badStmt, err := tx.Prepare(`INSERT INTO parse_errors
+		(import_id, kind, hjid, type, path, line, col, offset, error, fragment) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		_ = insStmt.Close()
+		_ = stmt.Close()
+		_ = delStmt.Close()
+		_ = subStmt.Close()
+		_ = arcStmt.Close()
+		_ = verStmt.Close()
+		_ = tx.Rollback()
+		return fmt.Errorf("preparing parse error insert: %w", err)
+	}
+
 	s.tx = tx
+	s.insStmt = insStmt
 	s.stmt = stmt
+	s.delStmt = delStmt
+	s.subStmt = subStmt
+	s.arcStmt = arcStmt
+	s.verStmt = verStmt
+	s.badStmt = badStmt
 	s.count = 0
 	return nil
 }
 
 func (s *Store) InsertElement(hjid, elementType, jsonData string) error {
-	if _, err := s.stmt.Exec(hjid, elementType, jsonData); err != nil {
+	return s.PutRecord(Record{Hjid: hjid, Type: elementType, Data: jsonData})
+}
+
+// DeleteElement removes an element by hjid. Deleting an element that does
+// not exist is not an error.
+func (s *Store) DeleteElement(hjid string) error {
+	return s.DeleteRecord(Record{Hjid: hjid, OpType: "D"})
+}
+
+// PutRecord inserts or replaces an element, moving the version it replaces
+// into the element's history. Replacing a record removes the children split
+// out of its previous version; its current children are written after it.
+func (s *Store) PutRecord(r Record) error {
+	if err := s.ensureBatch(r.ParentHjid == ""); err != nil {
+		return err
+	}
+	if err := s.deleteChildren(r); err != nil {
+		return err
+	}
+	args := []interface{}{
+		r.Hjid, r.Type, r.Data, s.currentImport(), r.Tree, r.Seq, r.Container, r.Nested, r.ParentHjid,
+		r.OpType, r.TransactionDate,
+	}
+	res, err := s.insStmt.Exec(args...)
+	if err != nil {
 		return fmt.Errorf("inserting element: %w", err)
 	}
-
-	s.count++
-	if s.count >= batchSize {
-		if err := s.Flush(); err != nil {
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("inserting element: %w", err)
+	} else if n == 0 {
+		if err := s.archive(r.Hjid); err != nil {
 			return err
 		}
-		if err := s.beginBatch(); err != nil {
-			return err
+		if _, err := s.stmt.Exec(args...); err != nil {
+			return fmt.Errorf("replacing element: %w", err)
 		}
 	}
+	if r.ParentHjid != "" {
+		s.hasChildren = true
+	}
 
+	s.inserted++
+	s.batchInserted++
+	s.written(r.ParentHjid == "")
 	return nil
 }
 
-func (s *Store) Flush() error {
-	if s.stmt != nil {
-		_ = s.stmt.Close()
-		s.stmt = nil
+// DeleteRecord removes an element, and any children split out of it, and
+// records the deletion in its version history.
+func (s *Store) DeleteRecord(r Record) error {
+	if err := s.ensureBatch(r.ParentHjid == ""); err != nil {
+		return err
+	}
+	if err := s.deleteChildren(r); err != nil {
+		return err
+	}
+	if err := s.archive(r.Hjid); err != nil {
+		return err
+	}
+	res, err := s.delStmt.Exec(r.Hjid)
+	if err != nil {
+		return fmt.Errorf("deleting element: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("deleting element: %w", err)
+	}
+	if err := s.addVersion(r); err != nil {
+		return err
+	}
+
+	// Deleting an element that isn't stored doesn't count.
+	s.deleted += int(n)
+	s.batchDeleted += int(n)
+	s.written(r.ParentHjid == "")
+	return nil
+}
+
+// QuarantineRecord stores a record the parser rejected in parse_errors.
+func (s *Store) QuarantineRecord(b BadRecord) error {
+	if err := s.ensureBatch(b.ParentHjid == ""); err != nil {
+		return err
+	}
+	_, err := s.badStmt.Exec(
+		s.currentImport(), b.Kind, b.Hjid, b.Type, b.Path, b.Line, b.Column, b.Offset, b.Error, b.Fragment,
+	)
+	if err != nil {
+		return fmt.Errorf("quarantining record: %w", err)
+	}
+
+	s.rejected++
+	s.batchRejected++
+	s.written(b.ParentHjid == "")
+	return nil
+}
+
+// deleteChildren removes the rows split out of a record read from the
+// source, and any split out of those in turn. Children are written after
+// their parent, so a child's own children are left alone.
+func (s *Store) deleteChildren(r Record) error {
+	if r.ParentHjid != "" || !s.hasChildren {
+		return nil
+	}
+	for parents := []string{r.Hjid}; len(parents) > 0; {
+		var children []string
+		for _, hjid := range parents {
+			deleted, err := s.deleteChildrenOf(hjid)
+			if err != nil {
+				return err
+			}
+			children = append(children, deleted...)
+		}
+		parents = children
+	}
+	return nil
+}
+
+// deleteChildrenOf removes the rows split out of hjid, returning their
+// hjids.
+func (s *Store) deleteChildrenOf(hjid string) ([]string, error) {
+	rows, err := s.subStmt.Query(hjid)
+	if err != nil {
+		return nil, fmt.Errorf("finding children of %s: %w", hjid, err)
+	}
+	var children []string
+	for rows.Next() {
+		var child string
+		if err := rows.Scan(&child); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("finding children of %s: %w", hjid, err)
+		}
+		children = append(children, child)
+	}
+	err = rows.Err()
+	_ = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("finding children of %s: %w", hjid, err)
+	}
+
+	for _, child := range children {
+		if err := s.archive(child); err != nil {
+			return nil, err
+		}
+		if _, err := s.delStmt.Exec(child); err != nil {
+			return nil, fmt.Errorf("deleting child %s of %s: %w", child, hjid, err)
+		}
+	}
+	return children, nil
+}
+
+// archive copies the stored version of hjid, if any, into its history.
+func (s *Store) archive(hjid string) error {
+	if _, err := s.arcStmt.Exec(hjid); err != nil {
+		return fmt.Errorf("archiving version of %s: %w", hjid, err)
+	}
+	return nil
+}
+
+// addVersion records the deletion r in its element's history, as no
+// version of a deleted element stays in elements.
+func (s *Store) addVersion(r Record) error {
+	_, err := s.verStmt.Exec(r.Hjid, r.Type, r.Data, r.OpType, r.TransactionDate, s.currentImport())
+	if err != nil {
+		return fmt.Errorf("recording version: %w", err)
+	}
+	return nil
+}
+
+// currentImport returns the id of the import in progress, or nil outside an
+// import.
+func (s *Store) currentImport() interface{} {
+	if s.importID == 0 {
+		return nil
+	}
+	return s.importID
+}
+
+// ensureBatch begins a batch if none is open. When a new record starts, a
+// full batch is committed first; rows split out of a record always join
+// its batch, so a checkpoint never falls part way through a record.
+func (s *Store) ensureBatch(record bool) error {
+	if record && s.count >= batchSize {
+		if err := s.Flush(); err != nil {
+			return err
+		}
 	}
 	if s.tx != nil {
+		return nil
+	}
+	return s.beginBatch()
+}
+
+// written counts a write against the current batch, and against the records
+// read from the source unless it was split out of one.
+func (s *Store) written(record bool) {
+	s.count++
+	if record {
+		s.records++
+		s.batchRecords++
+	}
+}
+
+func (s *Store) Flush() error {
+	s.closeStatements()
+	if s.tx != nil {
+		if err := s.saveCheckpoint(); err != nil {
+			return err
+		}
 		if err := s.tx.Commit(); err != nil {
 			return fmt.Errorf("committing batch: %w", err)
 		}
 		s.tx = nil
 	}
 	s.count = 0
+	s.batchInserted = 0
+	s.batchDeleted = 0
+	s.batchRejected = 0
+	s.batchRecords = 0
+	// An import's elements reach the search index and materialised
+	// tables once it ends.
+	if s.importID == 0 {
+		return s.syncPending()
+	}
+	return nil
+}
+
+// syncPending brings the search index and materialised tables up to date
+// with the elements written and removed since it last ran. Doing so as
+// each element is written, with triggers, slowed imports several times
+// over, as the driver compiles every trigger into each write.
+func (s *Store) syncPending() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := syncMaterialised(tx); err != nil {
+		return err
+	}
+	if err := indexPending(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM elements_pending"); err != nil {
+		return fmt.Errorf("clearing pending elements: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing pending elements: %w", err)
+	}
+	return nil
+}
+
+// Rollback discards the writes in the current batch, leaving everything
+// committed by earlier batches in place.
+func (s *Store) Rollback() error {
+	s.closeStatements()
+	if s.tx != nil {
+		if err := s.tx.Rollback(); err != nil {
+			return fmt.Errorf("rolling back batch: %w", err)
+		}
+		s.tx = nil
+	}
+	s.inserted -= s.batchInserted
+	s.deleted -= s.batchDeleted
+	s.rejected -= s.batchRejected
+	s.records -= s.batchRecords
+	s.count = 0
+	s.batchInserted = 0
+	s.batchDeleted = 0
+	s.batchRejected = 0
+	s.batchRecords = 0
 	return nil
 }
 
+func (s *Store) closeStatements() {
+	if s.insStmt != nil {
+		_ = s.insStmt.Close()
+		s.insStmt = nil
+	}
+	if s.stmt != nil {
+		_ = s.stmt.Close()
+		s.stmt = nil
+	}
+	if s.delStmt != nil {
+		_ = s.delStmt.Close()
+		s.delStmt = nil
+	}
+	if s.subStmt != nil {
+		_ = s.subStmt.Close()
+		s.subStmt = nil
+	}
+	if s.arcStmt != nil {
+		_ = s.arcStmt.Close()
+		s.arcStmt = nil
+	}
+	if s.verStmt != nil {
+		_ = s.verStmt.Close()
+		s.verStmt = nil
+	}
+	if s.badStmt != nil {
+		_ = s.badStmt.Close()
+		s.badStmt = nil
+	}
+}
+
 func (s *Store) TypeCounts() ([]TypeCount, error) {
 	rows, err := s.db.Query("SELECT type, count FROM type_counts")
 	if err != nil {
@@ -179,6 +649,37 @@ func (s *Store) Elements(elementType string, limit, offset int) ([]Element, erro
 	return elements, rows.Err()
 }
 
+// Children returns the records split out of an element, by type and hjid.
+func (s *Store) Children(parentHjid string, limit, offset int) ([]Element, error) {
+	rows, err := s.db.Query(
+		"SELECT hjid, type, data FROM elements WHERE parent_hjid = ? ORDER BY type, hjid LIMIT ? OFFSET ?",
+		parentHjid, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying children: %w", err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var elements []Element
+	for rows.Next() {
+		var e Element
+		if err := rows.Scan(&e.Hjid, &e.Type, &e.Data); err != nil {
+			return nil, fmt.Errorf("scanning element: %w", err)
+		}
+		elements = append(elements, e)
+	}
+	return elements, rows.Err()
+}
+
+func (s *Store) ChildCount(parentHjid string) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM elements WHERE parent_hjid = ?", parentHjid).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting children: %w", err)
+	}
+	return count, nil
+}
+
 func (s *Store) ElementCount(elementType string) (int, error) {
 	var count int
 	err := s.db.QueryRow("SELECT COUNT(*) FROM elements WHERE type = ?", elementType).Scan(&count)
@@ -190,19 +691,32 @@ func (s *Store) ElementCount(elementType string) (int, error) {
 
 func (s *Store) Element(hjid string) (*Element, error) {
 	var e Element
-	err := s.db.QueryRow(
-		"SELECT hjid, type, data FROM elements WHERE hjid = ?", hjid,
-	).Scan(&e.Hjid, &e.Type, &e.Data)
+	var source sql.NullString
+	err := s.db.QueryRow(`
+		SELECT e.hjid, e.type, e.data, i.name
+		FROM elements e LEFT JOIN imports i ON i.id = e.import_id
+		WHERE e.hjid = ?`, hjid,
+	).Scan(&e.Hjid, &e.Type, &e.Data, &source)
 	if err != nil {
 		return nil, fmt.Errorf("querying element: %w", err)
 	}
+	e.Source = source.String
 	return &e, nil
 }
 
-func (s *Store) Close() error {
-	if s.stmt != nil {
-		_ = s.stmt.Close()
+// NestedData returns an element's data with its hierarchy intact, or an
+// empty string if it was parsed without keeping it.
+func (s *Store) NestedData(hjid string) (string, error) {
+	var nested string
+	err := s.db.QueryRow("SELECT nested FROM elements WHERE hjid = ?", hjid).Scan(&nested)
+	if err != nil {
+		return "", fmt.Errorf("querying nested element: %w", err)
 	}
+	return nested, nil
+}
+
+func (s *Store) Close() error {
+	s.closeStatements()
 	if s.tx != nil {
 		_ = s.tx.Rollback()
 	}
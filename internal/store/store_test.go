@@ -12,6 +12,36 @@ func tempDB(t *testing.T) string {
 	return filepath.Join(dir, "test.db")
 }
 
+func TestOpenPathWithURICharacters(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a?b#c%20 d")
+	path := filepath.Join(dir, "x.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.InsertElement("1", "Measure", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("database not written to %s: %v", path, err)
+	}
+
+	ro, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenReadOnly: %v", err)
+	}
+	defer ro.Close() //nolint:errcheck
+	if _, err := ro.Element("1"); err != nil {
+		t.Errorf("Element: %v", err)
+	}
+}
+
 func TestOpenAndClose(t *testing.T) {
 	s, err := Open(tempDB(t))
 	if err != nil {
@@ -224,3 +254,121 @@ func TestBatchCommit(t *testing.T) {
 		t.Error("expected non-zero count")
 	}
 }
+
+func TestDeleteElement(t *testing.T) {
+	path := tempDB(t)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { _ = s.Close() }()
+
+	if err := s.InsertElement("1", "A", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.InsertElement("2", "A", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.DeleteElement("1"); err != nil {
+		t.Fatalf("DeleteElement: %v", err)
+	}
+	if err := s.DeleteElement("missing"); err != nil {
+		t.Fatalf("DeleteElement missing: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	count, err := s.ElementCount("A")
+	if err != nil {
+		t.Fatalf("ElementCount: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1, got %d", count)
+	}
+	if _, err := s.Element("1"); err == nil {
+		t.Error("expected deleted element to be gone")
+	}
+}
+
+func TestChildrenShareParentBatch(t *testing.T) {
+	s, err := Open(tempDB(t))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { _ = s.Close() }()
+
+	for i := 0; i < batchSize; i++ {
+		hjid := string(rune(i%26+'a')) + string(rune(i/26+'a'))
+		if err := s.InsertElement(hjid, "Bulk", `{}`); err != nil {
+			t.Fatalf("InsertElement %d: %v", i, err)
+		}
+	}
+	// The batch is full, but the child must still join its parent's batch.
+	child := Record{Hjid: "c1", Type: "Component", Data: `{}`, ParentHjid: "aa"}
+	if err := s.PutRecord(child); err != nil {
+		t.Fatalf("PutRecord child: %v", err)
+	}
+	if err := s.InsertElement("next", "Bulk", `{}`); err != nil {
+		t.Fatalf("InsertElement: %v", err)
+	}
+	if err := s.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	count, err := s.ElementCount("Bulk")
+	if err != nil {
+		t.Fatalf("ElementCount: %v", err)
+	}
+	if count != batchSize {
+		t.Errorf("Bulk count = %d, want %d committed before the next record", count, batchSize)
+	}
+	children, err := s.Children("aa", 10, 0)
+	if err != nil {
+		t.Fatalf("Children: %v", err)
+	}
+	if len(children) != 1 || children[0].Hjid != "c1" {
+		t.Errorf("Children = %v, want c1 committed with its parent", children)
+	}
+	if n, err := s.ChildCount("aa"); err != nil || n != 1 {
+		t.Errorf("ChildCount = %d, %v; want 1", n, err)
+	}
+}
+
+func TestReopenedStoreRemovesChildren(t *testing.T) {
+	path := tempDB(t)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, r := range []Record{
+		{Hjid: "1", Type: "Measure", Data: `{}`},
+		{Hjid: "11", Type: "MeasureComponent", Data: `{}`, ParentHjid: "1"},
+	} {
+		if err := s.PutRecord(r); err != nil {
+			t.Fatalf("PutRecord %s: %v", r.Hjid, err)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// A new session must still find the child stored by the last one.
+	s, err = OpenWith(path, OpenOptions{Append: true})
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer s.Close() //nolint:errcheck
+	if err := s.DeleteRecord(Record{Hjid: "1", OpType: "D"}); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if _, err := s.Element("11"); err == nil {
+		t.Error("child still stored after its parent was deleted")
+	}
+}
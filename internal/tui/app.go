@@ -11,6 +11,8 @@ const (
 	screenTypes screen = iota
 	screenElements
 	screenDetail
+	screenSearch
+	screenSchema
 )
 
 type App struct {
@@ -19,8 +21,21 @@ type App struct {
 	types   TypesModel
 	elems   ElementsModel
 	detail  DetailModel
-	width   int
-	height  int
+	search  SearchModel
+	schema  SchemaModel
+	// back holds the screens navigated away from, most recent last.
+	back   []view
+	width  int
+	height int
+}
+
+// view is a screen and the state of the models it was showing.
+type view struct {
+	current screen
+	elems   ElementsModel
+	detail  DetailModel
+	search  SearchModel
+	schema  SchemaModel
 }
 
 func NewApp(s *store.Store) App {
@@ -29,7 +44,9 @@ func NewApp(s *store.Store) App {
 		current: screenTypes,
 		types:   NewTypesModel(s),
 		elems:   NewElementsModel(s),
-		detail:  NewDetailModel(),
+		detail:  NewDetailModel(s),
+		search:  NewSearchModel(s),
+		schema:  NewSchemaModel(s),
 	}
 }
 
@@ -44,24 +61,16 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "ctrl+c":
 			return a, tea.Quit
 		case "q":
-			switch a.current {
-			case screenTypes:
+			if a.current == screenSearch && a.search.Typing() {
+				break
+			}
+			if a.current == screenTypes {
 				return a, tea.Quit
-			case screenElements:
-				a.current = screenTypes
-				return a, a.types.Init()
-			case screenDetail:
-				a.current = screenElements
-				return a, nil
 			}
+			return a.goBack()
 		case "esc":
-			switch a.current {
-			case screenElements:
-				a.current = screenTypes
-				return a, a.types.Init()
-			case screenDetail:
-				a.current = screenElements
-				return a, nil
+			if a.current != screenTypes {
+				return a.goBack()
 			}
 		}
 
@@ -71,16 +80,39 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		a.types = a.types.WithDimensions(msg.Width, msg.Height)
 		a.elems = a.elems.WithDimensions(msg.Width, msg.Height)
 		a.detail = a.detail.WithDimensions(msg.Width, msg.Height)
+		a.search = a.search.WithDimensions(msg.Width, msg.Height)
+		a.schema = a.schema.WithDimensions(msg.Width, msg.Height)
+
+	case NavigateToSearchMsg:
+		a.push()
+		a.current = screenSearch
+		var cmd tea.Cmd
+		a.search, cmd = a.search.Focus()
+		return a, cmd
+
+	case NavigateToSchemaMsg:
+		a.push()
+		a.current = screenSchema
+		a.schema = a.schema.ForType(msg.Type)
+		return a, a.schema.Init()
 
 	case NavigateToElementsMsg:
+		a.push()
 		a.current = screenElements
 		a.elems = a.elems.ForType(msg.Type, msg.Count)
 		return a, a.elems.Init()
 
 	case NavigateToDetailMsg:
+		a.push()
 		a.current = screenDetail
 		a.detail = a.detail.ForElement(msg.Hjid, msg.Data)
-		return a, nil
+		return a, a.detail.Init()
+
+	case NavigateToChildrenMsg:
+		a.push()
+		a.current = screenElements
+		a.elems = a.elems.ForParent(msg.Hjid, msg.Count)
+		return a, a.elems.Init()
 	}
 
 	var cmd tea.Cmd
@@ -91,11 +123,42 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		a.elems, cmd = a.elems.Update(msg)
 	case screenDetail:
 		a.detail, cmd = a.detail.Update(msg)
+	case screenSearch:
+		a.search, cmd = a.search.Update(msg)
+	case screenSchema:
+		a.schema, cmd = a.schema.Update(msg)
 	}
 
 	return a, cmd
 }
 
+func (a *App) push() {
+	a.back = append(a.back, view{current: a.current, elems: a.elems, detail: a.detail, search: a.search, schema: a.schema})
+}
+
+// goBack returns to the previous screen as it was left.
+func (a App) goBack() (tea.Model, tea.Cmd) {
+	if len(a.back) == 0 {
+		a.current = screenTypes
+		return a, a.types.Init()
+	}
+	prev := a.back[len(a.back)-1]
+	a.back = a.back[:len(a.back)-1]
+	a.current = prev.current
+	a.elems, a.detail, a.search, a.schema = prev.elems, prev.detail, prev.search, prev.schema
+	if a.width > 0 {
+		// The terminal may have been resized since.
+		a.elems = a.elems.WithDimensions(a.width, a.height)
+		a.detail = a.detail.WithDimensions(a.width, a.height)
+		a.search = a.search.WithDimensions(a.width, a.height)
+		a.schema = a.schema.WithDimensions(a.width, a.height)
+	}
+	if a.current == screenTypes {
+		return a, a.types.Init()
+	}
+	return a, nil
+}
+
 func (a App) View() string {
 	switch a.current {
 	case screenTypes:
@@ -104,6 +167,10 @@ func (a App) View() string {
 		return a.elems.View()
 	case screenDetail:
 		return a.detail.View()
+	case screenSearch:
+		return a.search.View()
+	case screenSchema:
+		return a.schema.View()
 	default:
 		return ""
 	}
@@ -118,3 +185,14 @@ type NavigateToDetailMsg struct {
 	Hjid string
 	Data string
 }
+
+type NavigateToChildrenMsg struct {
+	Hjid  string
+	Count int
+}
+
+type NavigateToSearchMsg struct{}
+
+type NavigateToSchemaMsg struct {
+	Type string
+}
@@ -8,17 +8,38 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/willfish/te/internal/store"
 )
 
 type DetailModel struct {
+	store    *store.Store
 	viewport viewport.Model
 	hjid     string
+	data     string
+	// nested is the element's unflattened data, loaded the first time it
+	// is shown.
+	nested     string
+	showNested bool
+	// children is the number of records split out of the element.
+	children int
 	width    int
 	height   int
 }
 
-func NewDetailModel() DetailModel {
+type childCountMsg struct {
+	hjid  string
+	count int
+}
+
+type nestedLoadedMsg struct {
+	hjid   string
+	nested string
+	err    error
+}
+
+func NewDetailModel(s *store.Store) DetailModel {
 	return DetailModel{
+		store:    s,
 		viewport: viewport.New(80, 24),
 	}
 }
@@ -33,7 +54,15 @@ func (m DetailModel) WithDimensions(w, h int) DetailModel {
 
 func (m DetailModel) ForElement(hjid, data string) DetailModel {
 	m.hjid = hjid
+	m.data = data
+	m.nested = ""
+	m.showNested = false
+	m.children = 0
+	m.setContent(data)
+	return m
+}
 
+func (m *DetailModel) setContent(data string) {
 	var buf bytes.Buffer
 	if err := json.Indent(&buf, []byte(data), "", "  "); err != nil {
 		buf.WriteString(data)
@@ -41,24 +70,91 @@ func (m DetailModel) ForElement(hjid, data string) DetailModel {
 
 	m.viewport.SetContent(buf.String())
 	m.viewport.GotoTop()
-	return m
 }
 
 func (m DetailModel) Init() tea.Cmd {
-	return nil
+	hjid := m.hjid
+	s := m.store
+	return func() tea.Msg {
+		count, err := s.ChildCount(hjid)
+		if err != nil {
+			return nil
+		}
+		return childCountMsg{hjid: hjid, count: count}
+	}
+}
+
+func (m DetailModel) loadNested() tea.Cmd {
+	hjid := m.hjid
+	s := m.store
+	return func() tea.Msg {
+		nested, err := s.NestedData(hjid)
+		return nestedLoadedMsg{hjid: hjid, nested: nested, err: err}
+	}
 }
 
 func (m DetailModel) Update(msg tea.Msg) (DetailModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case childCountMsg:
+		if msg.hjid == m.hjid {
+			m.children = msg.count
+		}
+		return m, nil
+
+	case nestedLoadedMsg:
+		if msg.hjid != m.hjid || !m.showNested {
+			return m, nil
+		}
+		switch {
+		case msg.err != nil:
+			m.viewport.SetContent(fmt.Sprintf("Nested data unavailable: %v", msg.err))
+		case msg.nested == "":
+			m.viewport.SetContent("No nested data stored for this element; parse the file again with --nested to keep it.")
+		default:
+			m.nested = msg.nested
+			m.setContent(msg.nested)
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "c" && m.children > 0 {
+			hjid, count := m.hjid, m.children
+			return m, func() tea.Msg {
+				return NavigateToChildrenMsg{Hjid: hjid, Count: count}
+			}
+		}
+		if msg.String() == "t" {
+			m.showNested = !m.showNested
+			if !m.showNested {
+				m.setContent(m.data)
+				return m, nil
+			}
+			if m.nested == "" {
+				return m, m.loadNested()
+			}
+			m.setContent(m.nested)
+			return m, nil
+		}
+	}
+
 	var cmd tea.Cmd
 	m.viewport, cmd = m.viewport.Update(msg)
 	return m, cmd
 }
 
 func (m DetailModel) View() string {
+	view := "flattened"
+	if m.showNested {
+		view = "nested"
+	}
 	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39")).
-		Render(fmt.Sprintf("Element %s", m.hjid))
+		Render(fmt.Sprintf("Element %s (%s)", m.hjid, view))
 	scrollPct := fmt.Sprintf("%3.f%%", m.viewport.ScrollPercent()*100)
-	help := lipgloss.NewStyle().Foreground(lipgloss.Color("241")).
-		Render("↑/↓/pgup/pgdn scroll • esc back")
+	keys := "↑/↓/pgup/pgdn scroll • t flattened/nested • esc back"
+	if m.children > 0 {
+		title += fmt.Sprintf("  %d children", m.children)
+		keys = "↑/↓/pgup/pgdn scroll • t flattened/nested • c children • esc back"
+	}
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render(keys)
 	return fmt.Sprintf("\n  %s  %s\n\n%s\n\n  %s", title, scrollPct, m.viewport.View(), help)
 }
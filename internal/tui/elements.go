@@ -26,11 +26,14 @@ type ElementsModel struct {
 	store       *store.Store
 	table       table.Model
 	elementType string
-	totalCount  int
-	offset      int
-	loaded      bool
-	width       int
-	height      int
+	// parent, when set, lists the children of that element instead of a
+	// type.
+	parent     string
+	totalCount int
+	offset     int
+	loaded     bool
+	width      int
+	height     int
 }
 
 func NewElementsModel(s *store.Store) ElementsModel {
@@ -50,6 +53,17 @@ func NewElementsModel(s *store.Store) ElementsModel {
 
 func (m ElementsModel) ForType(elementType string, count int) ElementsModel {
 	m.elementType = elementType
+	m.parent = ""
+	m.totalCount = count
+	m.offset = 0
+	m.loaded = false
+	return m
+}
+
+// ForParent lists the child records split out of an element.
+func (m ElementsModel) ForParent(hjid string, count int) ElementsModel {
+	m.elementType = ""
+	m.parent = hjid
 	m.totalCount = count
 	m.offset = 0
 	m.loaded = false
@@ -69,10 +83,17 @@ func (m ElementsModel) Init() tea.Cmd {
 
 func (m ElementsModel) loadPage() tea.Cmd {
 	elementType := m.elementType
+	parent := m.parent
 	offset := m.offset
 	s := m.store
 	return func() tea.Msg {
-		elements, err := s.Elements(elementType, pageSize, offset)
+		var elements []store.Element
+		var err error
+		if parent != "" {
+			elements, err = s.Children(parent, pageSize, offset)
+		} else {
+			elements, err = s.Elements(elementType, pageSize, offset)
+		}
 		if err != nil {
 			return nil
 		}
@@ -131,9 +152,13 @@ func (m ElementsModel) Update(msg tea.Msg) (ElementsModel, tea.Cmd) {
 	case elementsLoadedMsg:
 		rows := make([]table.Row, len(msg.elements))
 		for i, el := range msg.elements {
+			summary := summarise(el.Data)
+			if m.parent != "" {
+				summary = el.Type + ": " + summary
+			}
 			rows[i] = table.NewRow(table.RowData{
 				colHjid:    el.Hjid,
-				colSummary: summarise(el.Data),
+				colSummary: summary,
 				"data":     el.Data,
 			})
 		}
@@ -176,8 +201,12 @@ func (m ElementsModel) Update(msg tea.Msg) (ElementsModel, tea.Cmd) {
 }
 
 func (m ElementsModel) View() string {
+	heading := m.elementType
+	if m.parent != "" {
+		heading = "Children of " + m.parent
+	}
 	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39")).
-		Render(fmt.Sprintf("%s (%s total)", m.elementType, strconv.Itoa(m.totalCount)))
+		Render(fmt.Sprintf("%s (%s total)", heading, strconv.Itoa(m.totalCount)))
 	page := fmt.Sprintf("Page %d/%d", m.offset/pageSize+1, (m.totalCount+pageSize-1)/pageSize)
 	help := lipgloss.NewStyle().Foreground(lipgloss.Color("241")).
 		Render("↑/↓ navigate • enter detail • n/p next/prev page • / filter • q/esc back")
@@ -0,0 +1,143 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/evertras/bubble-table/table"
+	"github.com/willfish/te/internal/store"
+)
+
+const (
+	colField    = "field"
+	colTypes    = "types"
+	colFormat   = "format"
+	colAbsent   = "absent"
+	colNull     = "null"
+	colDistinct = "distinct"
+	colLength   = "length"
+	colExamples = "examples"
+)
+
+type schemaLoadedMsg struct {
+	schema store.TypeSchema
+	err    error
+}
+
+// SchemaModel shows the fields found in one element type's data.
+type SchemaModel struct {
+	store  *store.Store
+	table  table.Model
+	schema store.TypeSchema
+	err    error
+	loaded bool
+	width  int
+	height int
+}
+
+func NewSchemaModel(s *store.Store) SchemaModel {
+	columns := []table.Column{
+		table.NewColumn(colField, "Field", 40).WithFiltered(true),
+		table.NewColumn(colTypes, "Types", 16),
+		table.NewColumn(colFormat, "Format", 10),
+		table.NewColumn(colAbsent, "Absent", 8),
+		table.NewColumn(colNull, "Null", 8),
+		table.NewColumn(colDistinct, "Distinct", 10),
+		table.NewColumn(colLength, "Length", 10),
+		table.NewColumn(colExamples, "Examples", 50),
+	}
+
+	t := table.New(columns).
+		WithBaseStyle(lipgloss.NewStyle().Padding(0, 1)).
+		Focused(true).
+		WithPageSize(30).
+		HeaderStyle(lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39")))
+
+	return SchemaModel{store: s, table: t}
+}
+
+func (m SchemaModel) ForType(elementType string) SchemaModel {
+	m.schema = store.TypeSchema{Type: elementType}
+	m.err = nil
+	m.loaded = false
+	m.table = m.table.WithRows(nil)
+	return m
+}
+
+func (m SchemaModel) WithDimensions(w, h int) SchemaModel {
+	m.width = w
+	m.height = h
+	m.table = m.table.WithTargetWidth(w).WithPageSize(h - 6)
+	return m
+}
+
+func (m SchemaModel) Init() tea.Cmd {
+	elementType := m.schema.Type
+	s := m.store
+	return func() tea.Msg {
+		schema, err := s.InferSchema(elementType)
+		return schemaLoadedMsg{schema: schema, err: err}
+	}
+}
+
+func (m SchemaModel) Update(msg tea.Msg) (SchemaModel, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case schemaLoadedMsg:
+		if msg.schema.Type != m.schema.Type {
+			return m, nil
+		}
+		m.loaded = true
+		m.err = msg.err
+		m.schema = msg.schema
+		rows := make([]table.Row, len(msg.schema.Fields))
+		for i, f := range msg.schema.Fields {
+			examples := make([]string, len(f.Examples))
+			for j, e := range f.Examples {
+				examples[j] = strconv.Quote(e)
+			}
+			rows[i] = table.NewRow(table.RowData{
+				colField:    f.Path,
+				colTypes:    strings.Join(f.Types, "|"),
+				colFormat:   f.Format,
+				colAbsent:   percent(msg.schema.Elements-f.Present, msg.schema.Elements),
+				colNull:     percent(f.Nulls, msg.schema.Elements),
+				colDistinct: strconv.Itoa(f.Distinct),
+				colLength:   fmt.Sprintf("%d-%d", f.MinLength, f.MaxLength),
+				colExamples: strings.Join(examples, ", "),
+			})
+		}
+		m.table = m.table.WithRows(rows)
+		return m, nil
+	}
+
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+func percent(n, total int) string {
+	if n == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+}
+
+func (m SchemaModel) View() string {
+	heading := "Schema of " + m.schema.Type
+	switch {
+	case m.err != nil:
+		heading += fmt.Sprintf(" (error: %v)", m.err)
+	case !m.loaded:
+		heading += " (scanning…)"
+	default:
+		heading += fmt.Sprintf(" (%d elements, %d fields)", m.schema.Elements, len(m.schema.Fields))
+	}
+	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39")).Render(heading)
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color("241")).
+		Render("↑/↓ navigate • / filter • q/esc back")
+	return fmt.Sprintf("\n  %s\n\n%s\n\n  %s", title, m.table.View(), help)
+}
@@ -0,0 +1,170 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/evertras/bubble-table/table"
+	"github.com/willfish/te/internal/store"
+)
+
+const (
+	colMatch    = "match"
+	searchLimit = 100
+)
+
+type searchResultsMsg struct {
+	query   string
+	results []store.SearchResult
+	err     error
+}
+
+// SearchModel searches every element's values. Typing goes to the query
+// until a search runs; the results then take the keys until tab returns to
+// the query.
+type SearchModel struct {
+	store   *store.Store
+	input   textinput.Model
+	table   table.Model
+	query   string
+	count   int
+	err     error
+	loading bool
+	width   int
+	height  int
+}
+
+func NewSearchModel(s *store.Store) SearchModel {
+	input := textinput.New()
+	input.Placeholder = `frozen fish, "exact phrase", prefix*, a OR b, a NOT b`
+	input.Prompt = "Search: "
+
+	columns := []table.Column{
+		table.NewColumn(colHjid, "HJID", 20),
+		table.NewColumn(colType, "Type", 30),
+		table.NewColumn(colMatch, "Match", 80),
+	}
+
+	t := table.New(columns).
+		WithBaseStyle(lipgloss.NewStyle().Padding(0, 1)).
+		WithPageSize(30).
+		HeaderStyle(lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39")))
+
+	return SearchModel{store: s, input: input, table: t}
+}
+
+// Focus puts the cursor in the query.
+func (m SearchModel) Focus() (SearchModel, tea.Cmd) {
+	m.table = m.table.Focused(false)
+	return m, m.input.Focus()
+}
+
+// Typing reports whether keys go to the query.
+func (m SearchModel) Typing() bool {
+	return m.input.Focused()
+}
+
+func (m SearchModel) WithDimensions(w, h int) SearchModel {
+	m.width = w
+	m.height = h
+	m.input.Width = w - 12
+	m.table = m.table.WithTargetWidth(w).WithPageSize(h - 8)
+	return m
+}
+
+func (m SearchModel) search(query string) tea.Cmd {
+	s := m.store
+	return func() tea.Msg {
+		results, err := s.Search(query, "", searchLimit)
+		return searchResultsMsg{query: query, results: results, err: err}
+	}
+}
+
+func (m SearchModel) Update(msg tea.Msg) (SearchModel, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case searchResultsMsg:
+		if msg.query != m.query {
+			return m, nil
+		}
+		m.loading = false
+		m.err = msg.err
+		m.count = len(msg.results)
+		rows := make([]table.Row, len(msg.results))
+		for i, r := range msg.results {
+			rows[i] = table.NewRow(table.RowData{
+				colHjid:  r.Hjid,
+				colType:  r.Type,
+				colMatch: strings.Join(strings.Fields(r.Snippet), " "),
+			})
+		}
+		m.table = m.table.WithRows(rows).WithHighlightedRow(0)
+		if len(rows) > 0 {
+			m.input.Blur()
+			m.table = m.table.Focused(true)
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.input.Focused() {
+			if msg.String() == "enter" {
+				m.query = strings.TrimSpace(m.input.Value())
+				if m.query == "" {
+					return m, nil
+				}
+				m.loading = true
+				return m, m.search(m.query)
+			}
+			m.input, cmd = m.input.Update(msg)
+			return m, cmd
+		}
+
+		switch msg.String() {
+		case "tab", "/":
+			return m.Focus()
+		case "enter":
+			hjid, _ := m.table.HighlightedRow().Data[colHjid].(string)
+			if hjid == "" {
+				return m, nil
+			}
+			s := m.store
+			return m, func() tea.Msg {
+				e, err := s.Element(hjid)
+				if err != nil {
+					return nil
+				}
+				return NavigateToDetailMsg{Hjid: e.Hjid, Data: e.Data}
+			}
+		}
+	}
+
+	if m.input.Focused() {
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+	}
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+func (m SearchModel) View() string {
+	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39")).Render("Search")
+	status := ""
+	switch {
+	case m.loading:
+		status = "searching…"
+	case m.err != nil:
+		status = fmt.Sprintf("error: %v", m.err)
+	case m.query != "":
+		status = fmt.Sprintf("%d match(es) for %q", m.count, m.query)
+	}
+	help := "enter search • esc back"
+	if !m.input.Focused() {
+		help = "↑/↓ navigate • enter detail • tab edit query • q/esc back"
+	}
+	help = lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render(help)
+	return fmt.Sprintf("\n  %s  %s\n\n  %s\n\n%s\n\n  %s", title, status, m.input.View(), m.table.View(), help)
+}
@@ -76,6 +76,16 @@ func (m TypesModel) Update(msg tea.Msg) (TypesModel, tea.Cmd) {
 		return m, nil
 
 	case tea.KeyMsg:
+		if msg.String() == "s" && !m.table.GetIsFilterInputFocused() {
+			return m, func() tea.Msg { return NavigateToSearchMsg{} }
+		}
+		if msg.String() == "i" && m.loaded && !m.table.GetIsFilterInputFocused() {
+			typeName, _ := m.table.HighlightedRow().Data[colType].(string)
+			if typeName == "" {
+				return m, nil
+			}
+			return m, func() tea.Msg { return NavigateToSchemaMsg{Type: typeName} }
+		}
 		if msg.String() == "enter" && m.loaded {
 			selected := m.table.HighlightedRow()
 			typeName, _ := selected.Data[colType].(string)
@@ -96,6 +106,6 @@ func (m TypesModel) Update(msg tea.Msg) (TypesModel, tea.Cmd) {
 
 func (m TypesModel) View() string {
 	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39")).Render("Element Types")
-	help := lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render("↑/↓ navigate • enter select • / filter • q quit")
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render("↑/↓ navigate • enter select • i schema • / filter • s search • q quit")
 	return fmt.Sprintf("\n  %s\n\n%s\n\n  %s", title, m.table.View(), help)
 }